@@ -52,7 +52,8 @@ func (cmd Alert) Main(args []string) {
 		log.Fatal(err)
 	}
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGUSR1, syscall.SIGUSR2)
-	errChan, eventChan, cancelFunc = animate.Animate(cl, alert.Xft())
+	errChan, eventChan, cancelFunc = animate.Animate(cl, alert.Xft(),
+		animate.CoalesceEvents(alert.Coalesce))
 	for {
 		select {
 		case err, ok := <-errChan:
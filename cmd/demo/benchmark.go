@@ -0,0 +1,97 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"log"
+	"os"
+	"time"
+)
+
+type Benchmark struct{}
+
+func init()                        { cmds = append(cmds, Benchmark{}) }
+func (cmd Benchmark) Name() string { return "benchmark" }
+
+func (cmd Benchmark) Help(args []string) {
+	fmt.Printf("%s %s [COUNT]\n", os.Args[0], args[0])
+	fmt.Println("Time COUNT (default 100) gamma updates and report their latency.")
+	return
+}
+
+func (cmd Benchmark) Main(args []string) {
+	var (
+		cl    *gamma.Client
+		s     *gamma.Session
+		err   error
+		lut   gamma.LookupTable
+		count int = 100
+	)
+	if len(args) >= 2 {
+		n, err := fmt.Sscanf(args[1], "%d", &count)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if n != 1 || count < 1 {
+			log.Fatal("Error parsing arguments.")
+		}
+	}
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	if s, err = cl.NewSession(); err != nil {
+		log.Fatal(err)
+	}
+	if lut, err = s.GetLookupTable(); err != nil {
+		log.Fatal(err)
+	}
+	// Alternate between two slightly different ramps, so that every update
+	// changes something without being distracting.
+	fns := [2]gamma.XferFn{lut.XferFn(), lut.XferFn().Chain(gamma.DimFn(0.98))}
+	var min, max, total time.Duration
+	for idx := 0; idx < count; idx++ {
+		start := time.Now()
+		s.SetGamma(fns[idx%2])
+		// SetGamma doesn't wait for the X server, so make a round trip
+		// to be sure that the update has been processed.
+		if _, err = s.GetLookupTable(); err != nil {
+			break
+		}
+		elapsed := time.Since(start)
+		total += elapsed
+		if idx == 0 || elapsed < min {
+			min = elapsed
+		}
+		if elapsed > max {
+			max = elapsed
+		}
+	}
+	restoreErr := s.Restore(lut)
+	if restoreErr != nil &&
+		!errors.Is(restoreErr, gamma.ErrInexactRestore) {
+		log.Print(restoreErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	avg := total / time.Duration(count)
+	fmt.Printf("%d updates: min %v, avg %v, max %v (%.1f updates per second)\n",
+		count, min, avg, max, float64(time.Second)/float64(avg))
+	return
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"github.com/branen/go-xrr-gamma/gamma"
 	"log"
+	"math"
 	"os"
 )
 
@@ -28,17 +29,40 @@ func init()                      { cmds = append(cmds, Bilevel{}) }
 func (cmd Bilevel) Name() string { return "bilevel" }
 
 func (cmd Bilevel) Help(args []string) {
-	fmt.Printf("%s %s\n", os.Args[0], args[0])
-	fmt.Println("Make all the channels bilevel.")
+	fmt.Printf("%s %s [THRESHOLD | RED GREEN BLUE]\n", os.Args[0], args[0])
+	fmt.Println("Make all the channels bilevel, switching from 0 to 1 at THRESHOLD (default 0.5),")
+	fmt.Println("or at a separate threshold for each channel.")
 	return
 }
 
 func (cmd Bilevel) Main(args []string) {
 	var (
-		cl  *gamma.Client
-		s   *gamma.Session
-		err error
+		cl        *gamma.Client
+		s         *gamma.Session
+		err       error
+		threshold [3]float64 = [3]float64{0.5, 0.5, 0.5}
 	)
+	switch len(args) {
+	case 1:
+	case 2, 4:
+		for idx := range threshold {
+			arg := args[1]
+			if len(args) == 4 {
+				arg = args[1+idx]
+			}
+			n, err := fmt.Sscanf(arg, "%f", &threshold[idx])
+			if err != nil {
+				log.Fatal(err)
+			}
+			if n != 1 {
+				log.Fatal("Error parsing arguments.")
+			}
+			threshold[idx] = math.Max(math.Min(threshold[idx], 1), 0)
+		}
+	default:
+		cmd.Help(args)
+		return
+	}
 	if cl, err = gamma.NewClient(); err != nil {
 		log.Fatal(err)
 	}
@@ -46,7 +70,7 @@ func (cmd Bilevel) Main(args []string) {
 		log.Fatal(err)
 	}
 	s.SetGamma(func(ch gamma.Channel, in float64) float64 {
-		if in < 0.5 {
+		if in < threshold[ch] {
 			return 0
 		} else {
 			return 1
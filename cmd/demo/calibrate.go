@@ -0,0 +1,69 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"log"
+	"os"
+)
+
+type Calibrate struct{}
+
+func init()                        { cmds = append(cmds, Calibrate{}) }
+func (cmd Calibrate) Name() string { return "calibrate" }
+
+func (cmd Calibrate) Help(args []string) {
+	fmt.Printf("%s %s FILE\n", os.Args[0], args[0])
+	fmt.Println("Load the calibration curves from the vcgt tag of an ICC profile (or a bare vcgt tag).")
+	return
+}
+
+func (cmd Calibrate) Main(args []string) {
+	var (
+		cl   *gamma.Client
+		s    *gamma.Session
+		err  error
+		file *os.File
+		vcgt gamma.VCGT
+	)
+	if len(args) < 2 {
+		cmd.Help(args)
+		return
+	}
+	if file, err = os.Open(args[1]); err != nil {
+		log.Fatal(err)
+	}
+	vcgt, err = gamma.ReadVCGT(file)
+	file.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if vcgt.IsFormula {
+		fmt.Println("Detected a formula vcgt.")
+	} else {
+		fmt.Printf("Detected a table vcgt with %d entries.\n", vcgt.Size())
+	}
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	if s, err = cl.NewSession(); err != nil {
+		log.Fatal(err)
+	}
+	s.SetGamma(vcgt.XferFn())
+	return
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+type Compare struct{}
+
+func init()                      { cmds = append(cmds, Compare{}) }
+func (cmd Compare) Name() string { return "compare" }
+
+func (cmd Compare) Help(args []string) {
+	fmt.Printf("%s %s CMD_A CMD_B\n", os.Args[0], args[0])
+	fmt.Println("Toggle between two settings every second until interrupted, then restore the original lookup tables.")
+	fmt.Println("Each setting is a command as accepted by \"pipe\", e.g. \"2.2\" or \"temp 4500\".")
+	return
+}
+
+func (cmd Compare) Main(args []string) {
+	var (
+		cl      *gamma.Client
+		s       *gamma.Session
+		err     error
+		orig    gamma.LookupTable
+		fns     [2]gamma.XferFn
+		sigChan chan os.Signal = make(chan os.Signal, 1)
+	)
+	if len(args) < 3 {
+		cmd.Help(args)
+		return
+	}
+	for idx := range fns {
+		if fns[idx], err = parsePipeCmd(args[idx+1]); err != nil {
+			log.Fatalf("%q: %v", args[idx+1], err)
+		}
+	}
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	if s, err = cl.NewSession(); err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+	if orig, err = s.GetLookupTable(); err != nil {
+		log.Fatal(err)
+	}
+	signal.Notify(sigChan, os.Interrupt)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for active := 0; ; active = 1 - active {
+		s.SetGamma(fns[active])
+		fmt.Printf("%c: %s\n", 'A'+active, args[active+1])
+		select {
+		case <-ticker.C:
+			continue
+		case <-sigChan:
+		}
+		break
+	}
+	err = s.Restore(orig)
+	if err != nil && !errors.Is(err, gamma.ErrInexactRestore) {
+		log.Fatal(err)
+	}
+	return
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"github.com/branen/go-xrr-gamma/gamma/animate"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+)
+
+type Cycle struct{}
+
+func init()                    { cmds = append(cmds, Cycle{}) }
+func (cmd Cycle) Name() string { return "cycle" }
+
+func (cmd Cycle) Help(args []string) {
+	fmt.Printf("%s %s\n", os.Args[0], args[0])
+	fmt.Println("Cycle the color temperature from 2000K to 10000K and back over a minute.")
+	return
+}
+
+func (cmd Cycle) Main(args []string) {
+	var (
+		cl         *gamma.Client
+		errChan    <-chan error
+		cancelFunc animate.CancelFunc
+		sigChan    chan os.Signal = make(chan os.Signal, 1)
+		err        error
+	)
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	signal.Notify(sigChan, os.Interrupt)
+	errChan, _, cancelFunc = animate.Animate(cl, cycle)
+	for {
+		select {
+		case err, ok := <-errChan:
+			if ok {
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			return
+		case _, _ = <-sigChan:
+			cancelFunc()
+		}
+	}
+}
+
+func cycle(t time.Duration, baseFn gamma.XferFn, event interface{}) (fn gamma.XferFn, sleepFor time.Duration, exit bool) {
+	const period = time.Minute
+	stops := []float64{2000, 6500, 10000, 6500}
+	absStage, position := math.Modf(float64(t%period) / float64(period) * float64(len(stops)))
+	stage := int(absStage)
+	// Interpolate in mireds (reciprocal megakelvins), in which equal steps
+	// look roughly equally large.
+	from := 1e6 / stops[stage]
+	to := 1e6 / stops[(stage+1)%len(stops)]
+	kelvin := 1e6 / (from*(1-position) + to*position)
+	return baseFn.Chain(gamma.TemperatureFn(kelvin)), 0, false
+}
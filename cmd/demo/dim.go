@@ -16,6 +16,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/branen/go-xrr-gamma/gamma"
 	"log"
@@ -35,10 +36,10 @@ func (cmd Dim) Help(args []string) {
 
 func (cmd Dim) Main(args []string) {
 	var (
-		cl     *gamma.Client
-		s      *gamma.Session
-		err    error
-		baseFn gamma.XferFn
+		cl  *gamma.Client
+		s   *gamma.Session
+		err error
+		lut gamma.LookupTable
 	)
 	if cl, err = gamma.NewClient(); err != nil {
 		log.Fatal(err)
@@ -46,11 +47,14 @@ func (cmd Dim) Main(args []string) {
 	if s, err = cl.NewSession(); err != nil {
 		log.Fatal(err)
 	}
-	if lut, err := s.GetLookupTable(); err != nil {
+	if lut, err = s.GetLookupTable(); err != nil {
+		log.Fatal(err)
+	}
+	// GetLookupTable captures only the primary CRTC, so the others are
+	// resampled.
+	err = s.Restore(lut.Apply(gamma.DimFn(0.5)))
+	if err != nil && !errors.Is(err, gamma.ErrInexactRestore) {
 		log.Fatal(err)
-	} else {
-		baseFn = lut.XferFn()
 	}
-	s.SetGamma(gamma.DimFn(0.5).Mul(baseFn))
 	return
 }
@@ -24,18 +24,45 @@ Reset the lookup tables to their default.  (Same as "demo power 1".)
 Apply a power law function with exponent POWER and coefficient 1.
     $ demo power POWER
 
-Make all three color channels channels bilevel.
-    $ demo bilevel
+Make all three color channels channels bilevel, switching at THRESHOLD (default 0.5) or at a separate threshold per channel.
+    $ demo bilevel [THRESHOLD | RED GREEN BLUE]
+
+Load the calibration curves from the vcgt tag of an ICC profile (or a bare vcgt tag).
+    $ demo calibrate FILE
+
+Apply a named preset ("night", "reading", "cinema", or "default"), or list the presets if NAME is omitted.
+    $ demo preset [NAME]
+
+Read commands from stdin, one per line, and apply each immediately: an exponent for a power law function, "temp KELVIN", "dim COEF", or "reset".
+    $ demo pipe
 
 Read and Write-back
 
+Plot the current lookup tables of the primary CRTC.
+    $ demo show
+
+Time COUNT (default 100) gamma updates and report their latency.
+    $ demo benchmark [COUNT]
+
+Toggle between two settings, each a command as accepted by "pipe", every second until interrupted, then restore the original lookup tables.
+    $ demo compare CMD_A CMD_B
+
 Dim the existing lookup tables by 50%.
     $ demo dim
 
 Animation
 
-Make the screen pulse.
-    $ demo pulse
+Make the screen pulse, easing in and out of each stage if "smooth" is given.
+    $ demo pulse [smooth]
+
+Cycle the color temperature from 2000K to 10000K and back over a minute.
+    $ demo cycle
+
+Cycle a tint around the color wheel every ten seconds.
+    $ demo rainbow
+
+Sweep the power law exponent from 0.25 to 4 and back, printing its value, to find the right gamma by eye.
+    $ demo sweep
 
 Demo an "alert" effect with smooth transitions and event-driven accents.
 (Send SIGUSR1 to the process to "strobe" the screen, SIGUSR2 to "warble" the screen, or SIGINT to exit.)
@@ -0,0 +1,95 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"log"
+	"os"
+	"strings"
+)
+
+type Pipe struct{}
+
+func init()                   { cmds = append(cmds, Pipe{}) }
+func (cmd Pipe) Name() string { return "pipe" }
+
+func (cmd Pipe) Help(args []string) {
+	fmt.Printf("%s %s\n", os.Args[0], args[0])
+	fmt.Println("Read commands from stdin, one per line, and apply each immediately:")
+	fmt.Println("  EXPONENT      apply a power law function")
+	fmt.Println("  temp KELVIN   apply a color temperature")
+	fmt.Println("  dim COEF      dim by a coefficient")
+	fmt.Println("  reset         reset the gamma to its default")
+	return
+}
+
+func (cmd Pipe) Main(args []string) {
+	var (
+		cl  *gamma.Client
+		s   *gamma.Session
+		err error
+	)
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	// Keep one Session open across all of the updates.
+	if s, err = cl.NewSession(); err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if fn, err := parsePipeCmd(line); err != nil {
+			log.Printf("%q: %v", line, err)
+		} else {
+			s.SetGamma(fn)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return
+}
+
+func parsePipeCmd(line string) (fn gamma.XferFn, err error) {
+	var (
+		word string
+		val  float64
+	)
+	if _, err = fmt.Sscanf(line, "%f", &val); err == nil {
+		return gamma.PowerFn(val), nil
+	}
+	if line == "reset" {
+		return gamma.PowerFn(1), nil
+	}
+	if _, err = fmt.Sscanf(line, "%s %f", &word, &val); err != nil {
+		return nil, fmt.Errorf("Error parsing command.")
+	}
+	switch word {
+	case "temp":
+		return gamma.TemperatureFn(val), nil
+	case "dim":
+		return gamma.DimFn(val), nil
+	}
+	return nil, fmt.Errorf("Unknown command %q.", word)
+}
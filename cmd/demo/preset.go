@@ -0,0 +1,91 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"log"
+	"os"
+)
+
+type Preset struct{}
+
+func init()                     { cmds = append(cmds, Preset{}) }
+func (cmd Preset) Name() string { return "preset" }
+
+// presets are listed in the order that "demo preset" prints them.
+var presets = []struct {
+	name string
+	help string
+	fn   func() gamma.XferFn
+}{
+	{"night", "warm and dim, for late evenings", func() gamma.XferFn {
+		return gamma.NightFn(1).Chain(gamma.DimFn(0.7))
+	}},
+	{"reading", "reduced blue, for long stretches of text", func() gamma.XferFn {
+		return gamma.TemperatureFn(4500)
+	}},
+	{"cinema", "higher contrast, for video", func() gamma.XferFn {
+		fn, err := gamma.SplineFn([][2]float64{
+			{0, 0}, {0.25, 0.18}, {0.5, 0.5}, {0.75, 0.82}, {1, 1},
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return fn
+	}},
+	{"default", "the default lookup tables", func() gamma.XferFn {
+		return gamma.PowerFn(1)
+	}},
+}
+
+func (cmd Preset) Help(args []string) {
+	fmt.Printf("%s %s [NAME]\n", os.Args[0], args[0])
+	fmt.Println("Apply a named preset, or list the presets if NAME is omitted.")
+	return
+}
+
+func (cmd Preset) Main(args []string) {
+	var (
+		cl  *gamma.Client
+		s   *gamma.Session
+		err error
+		fn  gamma.XferFn
+	)
+	if len(args) < 2 {
+		for _, p := range presets {
+			fmt.Printf("%-10s%s\n", p.name, p.help)
+		}
+		return
+	}
+	for _, p := range presets {
+		if p.name == args[1] {
+			fn = p.fn()
+		}
+	}
+	if fn == nil {
+		log.Fatalf("Unknown preset %q.", args[1])
+	}
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	if s, err = cl.NewSession(); err != nil {
+		log.Fatal(err)
+	}
+	s.SetGamma(fn)
+	return
+}
@@ -16,9 +16,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/branen/go-xrr-gamma/gamma"
 	"github.com/branen/go-xrr-gamma/gamma/animate"
+	"github.com/branen/go-xrr-gamma/gamma/animate/ease"
 	"log"
 	"math"
 	"os"
@@ -32,55 +34,60 @@ func init()                    { cmds = append(cmds, Pulse{}) }
 func (cmd Pulse) Name() string { return "pulse" }
 
 func (cmd Pulse) Help(args []string) {
-	fmt.Printf("%s %s\n", os.Args[0], args[0])
-	fmt.Println("Make the screen pulse.")
+	fmt.Printf("%s %s [smooth]\n", os.Args[0], args[0])
+	fmt.Println("Make the screen pulse, easing in and out of each stage if \"smooth\" is given.")
 	return
 }
 
 func (cmd Pulse) Main(args []string) {
 	var (
-		cl         *gamma.Client
-		errChan    <-chan error
-		cancelFunc animate.CancelFunc
-		sigChan    chan os.Signal = make(chan os.Signal)
-		err        error
+		cl      *gamma.Client
+		sigChan chan os.Signal = make(chan os.Signal, 1)
+		err     error
+		easing  ease.Func = ease.Linear
 	)
+	if len(args) > 1 {
+		if args[1] != "smooth" {
+			cmd.Help(args)
+			return
+		}
+		easing = ease.SineInOut
+	}
 	if cl, err = gamma.NewClient(); err != nil {
 		log.Fatal(err)
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	signal.Notify(sigChan, os.Interrupt)
-	errChan, _, cancelFunc = animate.Animate(cl, pulse)
-	for {
-		select {
-		case err, ok := <-errChan:
-			if ok {
-				if err != nil {
-					log.Fatal(err)
-				}
-			}
-			return
-		case _, _ = <-sigChan:
-			cancelFunc()
-		}
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+	if err = animate.Run(cl, pulse(easing), animate.Context(ctx)); err != nil {
+		log.Fatal(err)
 	}
 }
 
-func pulse(t time.Duration, baseFn gamma.XferFn, event interface{}) (fn gamma.XferFn, sleepFor time.Duration, exit bool) {
-	absStage, position := math.Modf(float64(t) / float64(time.Second) * 2)
-	stage := math.Mod(absStage, 4)
-	from := func(start, end float64) float64 {
-		return start*(1-position) + end*position
-	}
-	var exp float64
-	switch stage {
-	case 0:
-		exp = from(1, 0.25)
-	case 1:
-		exp = from(0.25, 1)
-	case 2:
-		exp = from(1, 4)
-	case 3:
-		exp = from(4, 1)
+// pulse returns an animate.XferFnAtTime that pulses the screen in four
+// half-second stages, passing each stage's progress through easing.
+func pulse(easing ease.Func) animate.XferFnAtTime {
+	return func(t time.Duration, baseFn gamma.XferFn, event interface{}) (fn gamma.XferFn, sleepFor time.Duration, exit bool) {
+		absStage, position := math.Modf(float64(t) / float64(time.Second) * 2)
+		stage := math.Mod(absStage, 4)
+		position = easing(position)
+		from := func(start, end float64) float64 {
+			return start*(1-position) + end*position
+		}
+		var exp float64
+		switch stage {
+		case 0:
+			exp = from(1, 0.25)
+		case 1:
+			exp = from(0.25, 1)
+		case 2:
+			exp = from(1, 4)
+		case 3:
+			exp = from(4, 1)
+		}
+		return gamma.PowerFn(exp), 0, t >= 12*time.Second
 	}
-	return gamma.PowerFn(exp), 0, t >= 12*time.Second
 }
@@ -0,0 +1,96 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"github.com/branen/go-xrr-gamma/gamma/animate"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+)
+
+type Rainbow struct{}
+
+func init()                      { cmds = append(cmds, Rainbow{}) }
+func (cmd Rainbow) Name() string { return "rainbow" }
+
+func (cmd Rainbow) Help(args []string) {
+	fmt.Printf("%s %s\n", os.Args[0], args[0])
+	fmt.Println("Cycle a tint around the color wheel every ten seconds.")
+	fmt.Println()
+	fmt.Println("Each frame's tint is a ColorFn (a gamma.MatrixFn).  Since the")
+	fmt.Println("animation loop programs XferFns, each frame is applied through")
+	fmt.Println("ColorFn.XferFn, the gray-axis projection that SetColorGamma uses.")
+	return
+}
+
+func (cmd Rainbow) Main(args []string) {
+	var (
+		cl         *gamma.Client
+		errChan    <-chan error
+		cancelFunc animate.CancelFunc
+		sigChan    chan os.Signal = make(chan os.Signal, 1)
+		err        error
+	)
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	signal.Notify(sigChan, os.Interrupt)
+	errChan, _, cancelFunc = animate.Animate(cl, rainbow)
+	for {
+		select {
+		case err, ok := <-errChan:
+			if ok {
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			return
+		case _, _ = <-sigChan:
+			cancelFunc()
+		}
+	}
+}
+
+// rainbow tints the screen with a hue that advances around the color wheel.
+// The lookup tables can't rotate hues (only a matrix's row sums survive the
+// projection onto the gray axis; see gamma.ColorFn), so this tints with a
+// diagonal matrix instead: the channel nearest the current hue is left alone,
+// and the others are dimmed.
+func rainbow(t time.Duration, baseFn gamma.XferFn, event interface{}) (fn gamma.XferFn, sleepFor time.Duration, exit bool) {
+	const (
+		period   = 10 * time.Second
+		strength = 0.6
+	)
+	hue := 2 * math.Pi * float64(t%period) / float64(period)
+	var coef [3]float64
+	for ch := range coef {
+		// The channels' primaries are a third of a turn apart.
+		c := math.Cos(hue-2*math.Pi*float64(ch)/3)/2 + 0.5
+		coef[ch] = 1 - strength*(1-c)
+	}
+	max := math.Max(coef[0], math.Max(coef[1], coef[2]))
+	var m [3][3]float64
+	for ch := range m {
+		m[ch][ch] = coef[ch] / max
+	}
+	tint := gamma.MatrixFn(m)
+	return baseFn.Chain(tint.XferFn()), 0, false
+}
@@ -36,15 +36,13 @@ func (_ Reset) Help(args []string) {
 func (_ Reset) Main(args []string) {
 	var (
 		cl  *gamma.Client
-		s   *gamma.Session
 		err error
 	)
 	if cl, err = gamma.NewClient(); err != nil {
 		log.Fatal(err)
 	}
-	if s, err = cl.NewSession(); err != nil {
+	if err = cl.RestoreDefault(); err != nil {
 		log.Fatal(err)
 	}
-	s.SetGamma(gamma.PowerFn(1))
 	return
 }
@@ -0,0 +1,92 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Show struct{}
+
+func init()                   { cmds = append(cmds, Show{}) }
+func (cmd Show) Name() string { return "show" }
+
+func (cmd Show) Help(args []string) {
+	fmt.Printf("%s %s\n", os.Args[0], args[0])
+	fmt.Println("Plot the current lookup tables of the primary CRTC.")
+	return
+}
+
+func (cmd Show) Main(args []string) {
+	const (
+		height = 20
+		// The width is the terminal width (if $COLUMNS is set) less room
+		// for the axis.
+		defaultWidth = 64
+		axis         = 1
+	)
+	var (
+		cl  *gamma.Client
+		s   *gamma.Session
+		err error
+		lut gamma.LookupTable
+	)
+	width := defaultWidth
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil &&
+		cols > axis+1 {
+		width = cols - axis
+	}
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	if s, err = cl.NewSession(); err != nil {
+		log.Fatal(err)
+	}
+	if lut, err = s.GetLookupTable(); err != nil {
+		log.Fatal(err)
+	}
+	plot := make([][]byte, height)
+	for row := range plot {
+		plot[row] = []byte(strings.Repeat(" ", width))
+	}
+	for ch, mark := range []byte{'R', 'G', 'B'} {
+		ramp := lut.Channel(gamma.Channel(ch))
+		if len(ramp) == 0 {
+			continue
+		}
+		for col := 0; col < width; col++ {
+			val := ramp[col*len(ramp)/width]
+			row := height - 1 - int(val)*(height-1)/65535
+			if plot[row][col] == ' ' {
+				plot[row][col] = mark
+			} else {
+				// Overlapping channels.
+				plot[row][col] = '*'
+			}
+		}
+	}
+	fmt.Printf("%d entries per channel\n", len(lut.Channel(gamma.Red)))
+	for _, line := range plot {
+		fmt.Printf("|%s\n", line)
+	}
+	fmt.Printf("+%s\n", strings.Repeat("-", width))
+	return
+}
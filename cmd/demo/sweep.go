@@ -0,0 +1,78 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"github.com/branen/go-xrr-gamma/gamma/animate"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+)
+
+type Sweep struct{}
+
+func init()                    { cmds = append(cmds, Sweep{}) }
+func (cmd Sweep) Name() string { return "sweep" }
+
+func (cmd Sweep) Help(args []string) {
+	fmt.Printf("%s %s\n", os.Args[0], args[0])
+	fmt.Println("Sweep the power law exponent from 0.25 to 4 and back, printing its value, to find the right gamma by eye.")
+	return
+}
+
+func (cmd Sweep) Main(args []string) {
+	var (
+		cl         *gamma.Client
+		errChan    <-chan error
+		cancelFunc animate.CancelFunc
+		sigChan    chan os.Signal = make(chan os.Signal, 1)
+		err        error
+	)
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	signal.Notify(sigChan, os.Interrupt)
+	errChan, _, cancelFunc = animate.Animate(cl, sweep)
+	for {
+		select {
+		case err, ok := <-errChan:
+			fmt.Println()
+			if ok {
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			return
+		case _, _ = <-sigChan:
+			cancelFunc()
+		}
+	}
+}
+
+func sweep(t time.Duration, baseFn gamma.XferFn, event interface{}) (fn gamma.XferFn, sleepFor time.Duration, exit bool) {
+	const period = 40 * time.Second
+	// tri is a triangle wave that rises from 0 to 1 and falls back to 0
+	// over each period.
+	tri := 1 - math.Abs(2*math.Mod(float64(t)/float64(period), 1)-1)
+	// Sweep evenly in log space, so that 0.25-1 takes as long as 1-4.
+	exp := math.Pow(2, 4*tri-2)
+	fmt.Printf("\rexponent: %.3f", exp)
+	return gamma.PowerFn(exp), 0, false
+}
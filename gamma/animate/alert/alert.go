@@ -15,8 +15,8 @@
 
 // Package alert provides Xft, an event-responsive animate.XferFnAtTime
 // that turns the screen a soft red; two emphasis events (one gentle,
-// one bold); and an exit event that causes the animation to fade out
-// smoothly.
+// one bold); a white flash for critical alerts; and an exit event that
+// causes the animation to fade out smoothly.
 package alert
 
 import (
@@ -37,25 +37,133 @@ const (
 	Strobe
 	// Exits the animation with a smooth fade-out.
 	Exit
+	// Briefly flashes the screen white, for critical alerts.
+	FlashWhite
 )
 
+// IsExit reports whether cmd is Exit, implementing animate.Exiter.
+func (cmd Cmd) IsExit() bool {
+	return cmd == Exit
+}
+
+// BlendMode specifies how an Alert animation's red tint is combined with the
+// existing contents of the CRTC lookup tables.
+type BlendMode int
+
+const (
+	// Interpolates each channel toward the tint, pulling Red toward 1 and,
+	// during emphasis effects, Green and Blue toward 0.  This is the
+	// default.
+	Lerp BlendMode = iota
+	// Screens the tint over the existing ramps, like projecting red light
+	// onto the screen.  Green and Blue are never darkened.
+	Screen
+	// Adds the tint to the existing ramps, clipping at 1.  Like Screen,
+	// Green and Blue are never darkened, but Red retains its full contrast
+	// below the clipping point.
+	Add
+)
+
+type options struct {
+	blendMode     BlendMode
+	tintChannel   gamma.Channel
+	enterDuration time.Duration
+	exitDuration  time.Duration
+	maxEffects    int
+}
+
+// Option configures an Alert animation created by Xft.
+type Option func(o *options)
+
+// TintBlend sets the BlendMode used to apply the tint.  By default, Lerp is
+// used.
+func TintBlend(m BlendMode) Option {
+	return func(o *options) {
+		o.blendMode = m
+	}
+}
+
+// TintChannel sets the channel that the tint and emphasis effects drive, so
+// that the alert's color can match the meaning of the notification (e.g. Blue
+// for an informational alert).  By default, Red is used.  The descriptions of
+// the BlendModes refer to Red and to Green and Blue; with another channel,
+// their roles are swapped accordingly.
+func TintChannel(ch gamma.Channel) Option {
+	return func(o *options) {
+		o.tintChannel = ch
+	}
+}
+
+// EnterDuration sets the duration of the fade-in when the animation starts.
+// By default, the fade-in lasts 250ms.  A zero duration disables the fade-in.
+func EnterDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.enterDuration = d
+	}
+}
+
+// ExitDuration sets the duration of the fade-out after an Exit event.  By
+// default, the fade-out lasts 250ms.  A zero duration disables the fade-out.
+func ExitDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.exitDuration = d
+	}
+}
+
+// Coalesce merges consecutive identical Cmds, so that a burst of Strobe or
+// Warble events adds only one effect.  Pass it to animate.CoalesceEvents.
+func Coalesce(a, b interface{}) (interface{}, bool) {
+	if cmd, ok := a.(Cmd); ok && a == b && cmd != Exit {
+		return a, true
+	}
+	return nil, false
+}
+
+// MaxEffects limits the number of emphasis effects (i.e. warbles and strobes)
+// that may run at once.  When the limit is reached, a new effect replaces the
+// oldest running effect.  By default, up to 8 effects may run at once.  If n
+// isn't positive, emphasis events are ignored.
+func MaxEffects(n int) Option {
+	return func(o *options) {
+		o.maxEffects = n
+	}
+}
+
 type effect struct {
 	start time.Duration
 	apply func(since time.Duration, in float64) (out float64, done bool)
+	// White effects drive all channels toward 1 rather than emphasizing
+	// the tint.
+	white bool
 }
 
-func warble(since time.Duration, in float64) (out float64, done bool) {
-	const period = 125 * time.Millisecond
-	const cycles = 5
-	const weight = 1.0 / 12.0
-	const duration = period * cycles
-	if since > duration {
+// WarbleEvent is an event that warbles a running animation like Warble, but
+// with custom parameters.  Use WarbleWith to create one.
+type WarbleEvent struct {
+	period time.Duration
+	cycles int
+	weight float64
+}
+
+// WarbleWith returns an event that warbles a running animation for cycles
+// periods of length period.  At the bottom of each cycle, the tint is weaker
+// by weight.  Warble is equivalent to WarbleWith(125*time.Millisecond, 5,
+// 1.0/12.0).
+func WarbleWith(period time.Duration, cycles int, weight float64) WarbleEvent {
+	return WarbleEvent{period, cycles, weight}
+}
+
+var defaultWarble = WarbleWith(125*time.Millisecond, 5, 1.0/12.0)
+
+func (w WarbleEvent) apply(since time.Duration, in float64) (out float64, done bool) {
+	duration := w.period * time.Duration(w.cycles)
+	if since > duration || w.period <= 0 {
 		out = in
 		done = true
 	} else {
-		_, pos := math.Modf(float64(since) / float64(period))
+		_, pos := math.Modf(float64(since) / float64(w.period))
 		pow := math.Cos(2*math.Pi*pos)/2 + 0.5
-		out = 1 - ((1 - in) * ((1 - weight) + weight*pow))
+		out = 1 - ((1 - in) * ((1 - w.weight) + w.weight*pow))
 	}
 	return
 }
@@ -72,16 +180,74 @@ func strobe(since time.Duration, in float64) (out float64, done bool) {
 	return
 }
 
-// Xft returns an animate.XferFnAtTime instance that accepts events of type Cmd
-// through animate.Animate's EventChan.
-func Xft() animate.XferFnAtTime {
+// StrobeEvent is an event that strobes a running animation like Strobe, but
+// with a custom envelope.  Use StrobeWith to create one.
+type StrobeEvent struct {
+	attack time.Duration
+	decay  time.Duration
+}
+
+// StrobeWith returns an event that strobes a running animation with an
+// attack/decay envelope: the emphasis rises linearly to its peak over attack,
+// and then it falls back over decay, quickly at first and then slowly.  A
+// short attack and a long decay make the strobe snap on and linger.  (Strobe
+// itself starts at its peak and falls back linearly over 1.25s.)
+func StrobeWith(attack, decay time.Duration) StrobeEvent {
+	return StrobeEvent{attack, decay}
+}
+
+func (s StrobeEvent) apply(since time.Duration, in float64) (out float64, done bool) {
+	level, done := envelope(since, s.attack, s.decay)
+	return 1 - (1-in)*(1-0.5*level), done
+}
+
+// envelope returns the level, in [0, 1], of an attack/decay envelope at time
+// since, and whether the envelope has completed.
+func envelope(since, attack, decay time.Duration) (level float64, done bool) {
+	switch {
+	case since >= attack+decay:
+		return 0, true
+	case since < attack:
+		return float64(since) / float64(attack), false
+	default:
+		pos := 1 - float64(since-attack)/float64(decay)
+		return pos * pos, false
+	}
+}
+
+func flash(since time.Duration, in float64) (out float64, done bool) {
+	level, done := envelope(since, 40*time.Millisecond, 360*time.Millisecond)
+	return 1 - (1-in)*(1-level), done
+}
+
+// progress returns the fraction of duration d that has elapsed after time
+// since, saturating at 1.  A non-positive duration elapses immediately.
+func progress(since, d time.Duration) float64 {
+	if d <= 0 {
+		return 1
+	}
+	return math.Min(float64(since)/float64(d), 1)
+}
+
+// Xft returns an animate.XferFnAtTime instance that accepts events of type
+// Cmd, WarbleEvent, or StrobeEvent through animate.Animate's EventChan.
+func Xft(opts ...Option) animate.XferFnAtTime {
+	o := options{
+		blendMode:     Lerp,
+		tintChannel:   gamma.Red,
+		enterDuration: 250 * time.Millisecond,
+		exitDuration:  250 * time.Millisecond,
+		maxEffects:    8,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
 	type stageT int
 	const (
 		enter stageT = iota
 		static
 		exit
 	)
-	const enterExitDuration = 250 * time.Millisecond
 	var (
 		stage      stageT
 		stageStart time.Duration
@@ -89,22 +255,44 @@ func Xft() animate.XferFnAtTime {
 		strength   float64
 	)
 	var effects []effect = make([]effect, 0, 16)
+	addEffect := func(e effect) {
+		if o.maxEffects <= 0 {
+			return
+		}
+		if len(effects) < o.maxEffects {
+			effects = append(effects, e)
+			return
+		}
+		oldest := 0
+		for idx := range effects {
+			if effects[idx].start < effects[oldest].start {
+				oldest = idx
+			}
+		}
+		effects[oldest] = e
+	}
 
 	var (
 		cmd            Cmd
 		effectStrength float64
+		whiteStrength  float64
 		rCmp, oCmp     float64
 	)
 
-	return func(
+	level := func() float64 { return strength }
+	return animate.FadeOutOnExitFrom(o.exitDuration, level, func(
 		t time.Duration, baseFn gamma.XferFn, event interface{},
 	) (
 		fn gamma.XferFn, sleepFor time.Duration, exitFlag bool,
 	) {
-		if event == nil {
-			cmd = noCmd
-		} else {
-			cmd = event.(Cmd)
+		cmd = noCmd
+		switch event := event.(type) {
+		case Cmd:
+			cmd = event
+		case WarbleEvent:
+			addEffect(effect{t, event.apply, false})
+		case StrobeEvent:
+			addEffect(effect{t, event.apply, false})
 		}
 
 		setStage := func(s stageT) {
@@ -116,18 +304,18 @@ func Xft() animate.XferFnAtTime {
 		sinceStage = t - stageStart
 		switch cmd {
 		case Warble:
-			effects = append(effects, effect{t, warble})
+			addEffect(effect{t, defaultWarble.apply, false})
 		case Strobe:
-			effects = append(effects, effect{t, strobe})
+			addEffect(effect{t, strobe, false})
+		case FlashWhite:
+			addEffect(effect{t, flash, true})
 		case Exit:
-			switch stage {
-			case static:
-				setStage(exit)
-			case enter:
-				stage = exit
-				sinceStage = enterExitDuration - sinceStage
-				stageStart = t - sinceStage
+			// Hold the fade-in's current strength, from which
+			// FadeOutOnExitFrom fades out.
+			if stage == enter {
+				strength = progress(sinceStage, o.enterDuration)
 			}
+			stage = exit
 		}
 		cmd = noCmd
 		switch stage {
@@ -135,29 +323,24 @@ func Xft() animate.XferFnAtTime {
 			strength = 1
 			sleepFor = 2 * time.Second
 		case enter:
-			strength = float64(sinceStage) / float64(
-				enterExitDuration)
+			strength = progress(sinceStage, o.enterDuration)
 			sleepFor = 0
 			if strength >= 1 {
 				strength = 1
 				setStage(static)
 			}
-		case exit:
-			strength = 1 - float64(sinceStage)/float64(
-				enterExitDuration)
-			if strength < 0 {
-				strength = 0
-				exitFlag = true
-			}
-			sleepFor = 0
 		}
 
 		effectStrength = 0
+		whiteStrength = 0
 		for idx := 0; idx < len(effects); {
 			var done bool
 			effect := effects[idx]
-			effectStrength, done = effect.apply(t-effect.start,
-				effectStrength)
+			acc := &effectStrength
+			if effect.white {
+				acc = &whiteStrength
+			}
+			*acc, done = effect.apply(t-effect.start, *acc)
 			if done {
 				if idx < len(effects)-1 {
 					effects[idx] = effects[len(effects)-1]
@@ -175,15 +358,28 @@ func Xft() animate.XferFnAtTime {
 		fn = func(ch gamma.Channel, in float64) (out float64) {
 			base := baseFn(ch, in)
 			var fx float64
-			switch ch {
-			case gamma.Red:
-				fx = base*(1-rCmp) + rCmp
-			case gamma.Green, gamma.Blue:
-				fx = base * (1 - oCmp)
+			switch o.blendMode {
+			case Screen:
+				fx = base
+				if ch == o.tintChannel {
+					fx = 1 - (1-base)*(1-rCmp)
+				}
+			case Add:
+				fx = base
+				if ch == o.tintChannel {
+					fx = math.Min(base+rCmp, 1)
+				}
+			default:
+				if ch == o.tintChannel {
+					fx = base*(1-rCmp) + rCmp
+				} else {
+					fx = base * (1 - oCmp)
+				}
 			}
 			out = strength*fx + (1-strength)*base
+			out = out*(1-whiteStrength) + whiteStrength
 			return
 		}
 		return
-	}
+	})
 }
@@ -0,0 +1,267 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package alert
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool { return a > b-1e-9 && a < b+1e-9 }
+
+func TestExitDuringEnter(t *testing.T) {
+	xft := Xft(EnterDuration(time.Second), ExitDuration(time.Second))
+	base := gamma.IdentityFn()
+	fn, _, _ := xft(0, base, nil)
+	if out := fn(gamma.Red, 0); out != 0 {
+		t.Fatalf("expected the fade-in to start from baseFn, got %f", out)
+	}
+	// Halfway through the fade-in, the tint lifts black to 0.1.
+	fn, _, exit := xft(500*time.Millisecond, base, Exit)
+	if out := fn(gamma.Red, 0); !near(out, 0.1) || exit {
+		t.Fatalf("expected the fade-out to start at 0.1, got %f", out)
+	}
+	fn, _, exit = xft(750*time.Millisecond, base, nil)
+	if out := fn(gamma.Red, 0); !near(out, 0.05) || exit {
+		t.Fatalf("expected a half-finished fade-out, got %f", out)
+	}
+	fn, _, exit = xft(time.Second, base, nil)
+	if out := fn(gamma.Red, 0); out != 0 || !exit {
+		t.Fatalf("expected the animation to exit, got %f, %v", out, exit)
+	}
+}
+
+func TestTintBlend(t *testing.T) {
+	base := gamma.IdentityFn()
+	for _, c := range []struct {
+		mode       BlendMode
+		event      interface{}
+		in         float64
+		red, green float64
+	}{
+		// Without effects, Lerp and Screen agree, and only Red is
+		// tinted.
+		{Lerp, nil, 0.5, 0.6, 0.5},
+		{Screen, nil, 0.5, 0.6, 0.5},
+		{Add, nil, 0.5, 0.7, 0.5},
+		{Add, nil, 0.9, 1, 0.9},
+		// A strobe starts at half strength, and only Lerp darkens
+		// Green.
+		{Lerp, Strobe, 0.5, 0.75, 0.35},
+		{Screen, Strobe, 0.5, 0.75, 0.5},
+		{Add, Strobe, 0.5, 1, 0.5},
+	} {
+		xft := Xft(EnterDuration(0), TintBlend(c.mode))
+		fn, _, _ := xft(0, base, c.event)
+		red, green := fn(gamma.Red, c.in), fn(gamma.Green, c.in)
+		if !near(red, c.red) || !near(green, c.green) {
+			t.Fatalf("mode %d, %v at %g: expected (%g, %g), "+
+				"got (%g, %g)", c.mode, c.event, c.in, c.red,
+				c.green, red, green)
+		}
+	}
+}
+
+func TestStageDurations(t *testing.T) {
+	base := gamma.IdentityFn()
+	// With no effects, the tint lifts black to 0.2 times the strength.
+	strength := func(fn gamma.XferFn) float64 {
+		return fn(gamma.Red, 0) / 0.2
+	}
+
+	xft := Xft(EnterDuration(time.Second), ExitDuration(2*time.Second))
+	for _, c := range []struct {
+		t        time.Duration
+		event    interface{}
+		strength float64
+		exit     bool
+	}{
+		{0, nil, 0, false},
+		{500 * time.Millisecond, nil, 0.5, false},
+		{time.Second, nil, 1, false},
+		{1500 * time.Millisecond, nil, 1, false},
+		{2 * time.Second, Exit, 1, false},
+		{3 * time.Second, nil, 0.5, false},
+		{4 * time.Second, nil, 0, true},
+	} {
+		fn, _, exit := xft(c.t, base, c.event)
+		if s := strength(fn); !near(s, c.strength) || exit != c.exit {
+			t.Fatalf("at %v: expected (%g, %v), got (%g, %v)",
+				c.t, c.strength, c.exit, s, exit)
+		}
+	}
+
+	// Zero durations skip the stages.
+	xft = Xft(EnterDuration(0), ExitDuration(0))
+	if fn, _, _ := xft(0, base, nil); !near(strength(fn), 1) {
+		t.Fatal("expected no fade-in")
+	}
+	if fn, _, exit := xft(time.Second, base, Exit); strength(fn) != 0 ||
+		!exit {
+		t.Fatal("expected no fade-out")
+	}
+}
+
+func TestWarbleWith(t *testing.T) {
+	w := WarbleWith(100*time.Millisecond, 2, 0.5)
+	for _, c := range []struct {
+		since time.Duration
+		out   float64
+		done  bool
+	}{
+		// Each cycle starts at full strength and dips by weight.
+		{0, 0, false},
+		{25 * time.Millisecond, 0.25, false},
+		{50 * time.Millisecond, 0.5, false},
+		{100 * time.Millisecond, 0, false},
+		{150 * time.Millisecond, 0.5, false},
+		{200 * time.Millisecond, 0, false},
+		// After the last cycle, the input passes through.
+		{201 * time.Millisecond, 0, true},
+	} {
+		out, done := w.apply(c.since, 0)
+		if !near(out, c.out) || done != c.done {
+			t.Fatalf("at %v: expected (%g, %v), got (%g, %v)",
+				c.since, c.out, c.done, out, done)
+		}
+	}
+	if out, done := w.apply(time.Second, 0.3); out != 0.3 || !done {
+		t.Fatalf("expected a finished warble to pass 0.3 through, "+
+			"got (%g, %v)", out, done)
+	}
+	if _, done := WarbleWith(0, 5, 0.5).apply(0, 0); !done {
+		t.Fatal("expected a warble with no period to finish at once")
+	}
+}
+
+func TestMaxEffects(t *testing.T) {
+	base := gamma.IdentityFn()
+	short := StrobeWith(0, time.Second)
+	long := StrobeWith(0, 10*time.Second)
+
+	xft := Xft(EnterDuration(0), MaxEffects(2))
+	xft(0, base, short)
+	xft(100*time.Millisecond, base, long)
+	// The third effect replaces the oldest one, the short strobe.
+	xft(200*time.Millisecond, base, long)
+	fn, _, _ := xft(500*time.Millisecond, base, nil)
+	var strength float64
+	for _, since := range []time.Duration{
+		400 * time.Millisecond, 300 * time.Millisecond,
+	} {
+		strength, _ = long.apply(since, strength)
+	}
+	// Under Lerp, the effects darken Green by 0.6 times their strength.
+	if out := fn(gamma.Green, 1); !near(out, 1-0.6*strength) {
+		t.Fatalf("expected only the long strobes to survive, got %g",
+			out)
+	}
+
+	xft = Xft(EnterDuration(0), MaxEffects(0))
+	if fn, _, _ = xft(0, base, Strobe); fn(gamma.Green, 1) != 1 {
+		t.Fatal("expected the strobe to be ignored")
+	}
+}
+
+func TestFlashWhite(t *testing.T) {
+	base := gamma.IdentityFn()
+	xft := Xft(EnterDuration(0))
+	xft(0, base, FlashWhite)
+	// The flash peaks at white after 40ms.
+	fn, sleepFor, _ := xft(40*time.Millisecond, base, nil)
+	for ch := gamma.Red; ch <= gamma.Blue; ch++ {
+		if out := fn(ch, 0); !near(out, 1) {
+			t.Fatalf("channel %d: expected white, got %g", ch, out)
+		}
+	}
+	if sleepFor != 0 {
+		t.Fatal("expected the flash to animate")
+	}
+	// After 400ms, it's done, and the tint is left alone.
+	fn, sleepFor, _ = xft(400*time.Millisecond, base, nil)
+	if out := fn(gamma.Green, 0); out != 0 || sleepFor == 0 {
+		t.Fatalf("expected the flash to be done, got %g", out)
+	}
+	out, done := flash(400*time.Millisecond, 0.3)
+	if !near(out, 0.3) || !done {
+		t.Fatalf("expected done, got (%g, %v)", out, done)
+	}
+}
+
+func TestTintChannel(t *testing.T) {
+	base := gamma.IdentityFn()
+	for _, c := range []struct {
+		mode BlendMode
+		want [3]float64
+	}{
+		// During a strobe, Lerp pulls the other channels down.
+		{Lerp, [3]float64{0.35, 0.35, 0.75}},
+		{Screen, [3]float64{0.5, 0.5, 0.75}},
+		{Add, [3]float64{0.5, 0.5, 1}},
+	} {
+		xft := Xft(EnterDuration(0), TintChannel(gamma.Blue),
+			TintBlend(c.mode))
+		fn, _, _ := xft(0, base, Strobe)
+		for ch := gamma.Red; ch <= gamma.Blue; ch++ {
+			if out := fn(ch, 0.5); !near(out, c.want[ch]) {
+				t.Fatalf("mode %d, channel %d: expected %g, got %g",
+					c.mode, ch, c.want[ch], out)
+			}
+		}
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	const ms = time.Millisecond
+	for _, c := range []struct {
+		since, attack, decay time.Duration
+		level                float64
+		done                 bool
+	}{
+		// The attack is linear, and the decay is quadratic.
+		{0, 100 * ms, 100 * ms, 0, false},
+		{50 * ms, 100 * ms, 100 * ms, 0.5, false},
+		{100 * ms, 100 * ms, 100 * ms, 1, false},
+		{150 * ms, 100 * ms, 100 * ms, 0.25, false},
+		{200 * ms, 100 * ms, 100 * ms, 0, true},
+		// Without an attack, the envelope starts at its peak.
+		{0, 0, 100 * ms, 1, false},
+		{50 * ms, 0, 100 * ms, 0.25, false},
+		// Without a decay, it ends at its peak.
+		{50 * ms, 100 * ms, 0, 0.5, false},
+		{100 * ms, 100 * ms, 0, 0, true},
+		// Without either, it's done at once.
+		{0, 0, 0, 0, true},
+	} {
+		level, done := envelope(c.since, c.attack, c.decay)
+		if !near(level, c.level) || done != c.done {
+			t.Fatalf("%v into (%v, %v): expected (%g, %v), "+
+				"got (%g, %v)", c.since, c.attack, c.decay,
+				c.level, c.done, level, done)
+		}
+	}
+
+	// At its peak, a strobe lifts black halfway.
+	s := StrobeWith(100*ms, 100*ms)
+	if out, done := s.apply(100*ms, 0); !near(out, 0.5) || done {
+		t.Fatalf("expected a half-strength peak, got (%g, %v)", out, done)
+	}
+	if out, done := s.apply(200*ms, 0.3); !near(out, 0.3) || !done {
+		t.Fatalf("expected a finished strobe to pass 0.3 through, "+
+			"got (%g, %v)", out, done)
+	}
+}
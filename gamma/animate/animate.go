@@ -19,8 +19,12 @@
 package animate
 
 import (
+	"context"
 	"fmt"
 	"github.com/branen/go-xrr-gamma/gamma"
+	"math"
+	"os"
+	"os/signal"
 	"time"
 )
 
@@ -60,17 +64,28 @@ type CancelFunc func()
 type EventChan chan<- interface{}
 
 type options struct {
-	cl            *gamma.Client
-	xft           XferFnAtTime
-	err           chan error
-	cancel        chan struct{}
-	event         chan interface{}
+	cl     *gamma.Client
+	xft    XferFnAtTime
+	err    chan error
+	cancel chan struct{}
+	event  chan interface{}
 
 	startClockBeforeSetup bool
 	initialClock          time.Duration
 	updateInterval        time.Duration
 	exitOnForeignUpdate   bool
 	restoreOnExit         bool
+	maxFrames             int
+	restoreSignals        []os.Signal
+	initialBase           gamma.XferFn
+	skipInitialRead       bool
+	onForeignUpdate       func(old, new gamma.LookupTable)
+	changeTolerance       uint16
+	coalesceEvents        func(a, b interface{}) (interface{}, bool)
+	fixedCadence          bool
+	updateIntervalFn      func(t time.Duration) time.Duration
+	warmupFrame           bool
+	ctx                   context.Context
 }
 
 type Option func(o *options)
@@ -103,6 +118,23 @@ func UpdateInterval(i time.Duration) Option {
 	}
 }
 
+/*
+UpdateIntervalFunc sets a function that computes the update interval (see
+UpdateInterval) for each frame from the animation clock t at which the frame
+was rendered, overriding UpdateInterval and UpdatesPerSecond.  This lets an
+animation change its frame rate as it runs, e.g. to save energy by slowing down
+as it settles toward a static state.  Where a non-positive interval is
+returned, the fixed interval is used instead.
+
+With FixedCadence, the ticker is restarted whenever the interval changes, which
+starts a new grid at the current frame.
+*/
+func UpdateIntervalFunc(fn func(t time.Duration) time.Duration) Option {
+	return func(o *options) {
+		o.updateIntervalFn = fn
+	}
+}
+
 // UpdatesPerSecond sets the maximum number of times per second that the CRTCs
 // will be reprogrammed.  By default, the CRTCs are updated at most 30 times
 // per second.  (This is an alternative to UpdateInterval.)
@@ -112,16 +144,66 @@ func UpdatesPerSecond(u float64) Option {
 	}
 }
 
+// Context causes the animation to exit when ctx is done, as though it had
+// been cancelled.  This is the only way to cancel an animation started by
+// Run.
+func Context(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WarmupFrame, if true, programs the CRTCs with baseFn (see XferFnAtTime), and
+// waits for the X server to apply it, immediately before the first frame.
+// Some displays flash when their lookup tables are first programmed after
+// being idle; the warm-up frame takes that flash without changing the picture,
+// so that the animation's first visible change is smooth.  By default, there's
+// no warm-up frame.
+func WarmupFrame(b bool) Option {
+	return func(o *options) {
+		o.warmupFrame = b
+	}
+}
+
+/*
+FixedCadence, if true, paces the animation with a time.Ticker, so that frames
+land on a regular grid spaced by the update interval (see UpdateInterval) and
+the XferFnAtTime's sleepFor is rounded up to the next tick.  This avoids the
+long-term drift of the default adaptive scheme, in which each frame's sleep is
+recomputed from the measured duration of the last one, and so processing
+jitter accumulates.  The tradeoff is that a frame that takes longer than the
+update interval causes the ticks it overlaps to be dropped, rather than merely
+delaying the following frame.  By default, the adaptive scheme is used.
+*/
+func FixedCadence(b bool) Option {
+	return func(o *options) {
+		o.fixedCadence = b
+	}
+}
+
 // ExitOnForeignUpdate, if true, causes the animation to return
 // ForeignCrtcUpdate and exit if another process updates the CRTC lookup
 // while the animation is running.  This is the default.  If false, the
-// animation updates baseFn (see XferFnAtTime) and continues running.
+// animation updates baseFn (see XferFnAtTime) and continues running; use
+// OnForeignUpdate to be notified when that happens.
 func ExitOnForeignUpdate(b bool) Option {
 	return func(o *options) {
 		o.exitOnForeignUpdate = b
 	}
 }
 
+// OnForeignUpdate sets a function that's called when the animation detects
+// and absorbs a foreign update (see ExitOnForeignUpdate(false)).  old holds the
+// lookup tables as the animation last left them, and new holds them as the
+// other process left them.  fn is called from the animation's goroutine, so
+// it should return promptly.  It's never called if the animation exits on
+// foreign updates.
+func OnForeignUpdate(fn func(old, new gamma.LookupTable)) Option {
+	return func(o *options) {
+		o.onForeignUpdate = fn
+	}
+}
+
 // RestoreOnExit, if true, causes the the baseFn (see XferFnAtTime) to be
 // applied to the CRTCs when the animation exits.  This the default.  If false,
 // the CRTCs are left with the last state set by the animation loop before
@@ -132,12 +214,229 @@ func RestoreOnExit(b bool) Option {
 	}
 }
 
+// ChangeTolerance sets how much a frame's lookup table values may differ from
+// the previous frame's before the CRTCs are reprogrammed.  Frames within the
+// tolerance aren't sent to the X server (see gamma.Session.SetGammaIfChanged),
+// which saves X traffic during static stretches of an animation.  By default,
+// the tolerance is 0, so only frames that are exactly unchanged are skipped.
+func ChangeTolerance(tolerance uint16) Option {
+	return func(o *options) {
+		o.changeTolerance = tolerance
+	}
+}
+
+/*
+MaxFrames causes the animation to exit after n frames, as though the
+XferFnAtTime had returned exit on the nth frame.  A frame is one call to the
+XferFnAtTime, so frames that aren't sent to the X server (see ChangeTolerance)
+count, and a run of n frames is the same length however static it is; the
+warm-up frame (see WarmupFrame) doesn't count.  So the CRTCs are programmed at
+most n times, plus once for the warm-up frame and once more on exit if
+RestoreOnExit is in effect.  By default, or if n is zero, the number of frames
+is unlimited.
+*/
+func MaxFrames(n int) Option {
+	return func(o *options) {
+		o.maxFrames = n
+	}
+}
+
+/*
+InitialBase seeds the animation's baseFn (see XferFnAtTime) with fn, rather
+than deriving it from the CRTC lookup tables when the animation starts.  This
+allows animations to be chained without a visible snap: run the outgoing
+animation with RestoreOnExit(false), and pass its final XferFn to the incoming
+animation via InitialBase.
+
+Foreign updates (see ExitOnForeignUpdate) are still detected as usual once the
+animation has programmed the CRTCs.
+*/
+func InitialBase(fn gamma.XferFn) Option {
+	return func(o *options) {
+		o.initialBase = fn
+	}
+}
+
+/*
+SkipInitialRead, if true, causes an animation that has an InitialBase to start
+without reading the CRTC lookup tables first.  Ordinarily, the first frame is
+preceded by a read, which is merely redundant when InitialBase supplies the
+baseFn (see XferFnAtTime), but which can delay or prevent the start of the
+animation on displays whose lookup tables are slow or unreliable to read.  It
+has no effect without InitialBase.  By default, the initial read is made.
+
+The lookup tables are still read after each frame, so foreign updates (see
+ExitOnForeignUpdate) made while the animation is running are detected as usual.
+But an update made before the first frame will go unnoticed and be overwritten,
+so a caller that needs to detect one must hold its own baseline LookupTable and
+check it with gamma.Session.ForeignUpdateSince before starting the animation.
+
+Since such displays may fail the later reads too, SkipInitialRead also keeps
+the animation running when a read fails, rather than ending it with the error.
+Foreign updates go undetected until a read after a programmed frame succeeds.
+*/
+func SkipInitialRead(b bool) Option {
+	return func(o *options) {
+		o.skipInitialRead = b
+	}
+}
+
+/*
+CoalesceEvents sets a function that merges events which arrive faster than the
+animation consumes them.  When the animation receives an event, it also
+receives any events whose sends are already blocked on the EventChan, and it
+calls merge(a, b) with the accumulated event a and each subsequent event b.  If
+merge returns true, its result replaces both events; otherwise, a is delivered
+to the XferFnAtTime, and b is delivered on the following frame.
+
+By default, events are never merged, so every event is delivered in its own
+frame.
+*/
+func CoalesceEvents(merge func(a, b interface{}) (interface{}, bool)) Option {
+	return func(o *options) {
+		o.coalesceEvents = merge
+	}
+}
+
+// coalesceEvents merges event with any events that are ready to be received
+// on o.event.  It returns the merged event and the first event that couldn't
+// be merged (or nil).
+func coalesceEvents(o options, event interface{}) (merged, pending interface{}) {
+	for {
+		select {
+		case next := <-o.event:
+			var ok bool
+			if merged, ok = o.coalesceEvents(event, next); !ok {
+				return event, next
+			}
+			event = merged
+		default:
+			return event, nil
+		}
+	}
+}
+
+/*
+RestoreOnSignal installs a handler for the given signals (e.g. syscall.SIGTERM
+and syscall.SIGINT) for the lifetime of the animation.  When one of them is
+received, the animation exits as though it had been cancelled--restoring
+baseFn (see XferFnAtTime) unless RestoreOnExit(false) is in effect--and the
+signal is then raised again, so that the process terminates (or the
+application's own handlers run) just as it would have without the animation.
+
+This is a best-effort mechanism: SIGKILL can't be caught, so a process killed
+with SIGKILL will still leave the CRTCs in the animation's last state.  (See
+gamma.Client.RestoreDefault for a way to recover from that.)
+*/
+func RestoreOnSignal(sigs ...os.Signal) Option {
+	return func(o *options) {
+		o.restoreSignals = sigs
+	}
+}
+
+// Exiter is implemented by events that can ask an animation wrapped by
+// FadeOutOnExit or FadeOutOnExitFrom to fade out and exit.
+type Exiter interface {
+	IsExit() bool
+}
+
+// ExitEvent is an Exiter that always asks for a fade-out.
+type ExitEvent struct{}
+
+func (ExitEvent) IsExit() bool { return true }
+
+/*
+ReloadBase is an event that makes the animation re-derive its baseFn (see
+XferFnAtTime) from the CRTC lookup tables at the start of the next frame, as
+though a foreign update had been detected with ExitOnForeignUpdate(false).  The
+event is consumed by the animation loop, so the XferFnAtTime receives nil in
+its place.
+
+Send ReloadBase only when the lookup tables hold a state that the animation
+didn't program (e.g. right after another tool has run); otherwise, the
+animation's own output becomes its baseFn.
+*/
+type ReloadBase struct{}
+
+/*
+FadeOutOnExit wraps XferFnAtTime xft so that, when it receives an event
+implementing Exiter whose IsExit method returns true, the animation fades
+smoothly from xft's output back to baseFn over the given duration and then
+exits.
+
+Exit events are consumed by the wrapper; xft receives a nil event in their
+place.  Other events are passed through to xft, which continues to be
+evaluated during the fade.  If xft asks to exit on its own, the wrapper exits
+immediately.
+*/
+func FadeOutOnExit(duration time.Duration, xft XferFnAtTime) XferFnAtTime {
+	return FadeOutOnExitFrom(duration, nil, xft)
+}
+
+/*
+FadeOutOnExitFrom is like FadeOutOnExit, but for an xft whose effect isn't
+always at full strength, e.g. because it fades itself in.  level reports the
+strength of xft's effect, from 0 (baseFn) to 1; it's called once, when the exit
+event arrives, after xft has rendered that frame.  The fade-out starts from
+that level and proceeds at the same rate as a full-strength fade, so it takes
+level times duration.
+
+Unlike FadeOutOnExit, the wrapper passes the first exit event through to xft,
+so that xft can hold its strength steady (e.g. by ending its fade-in) while the
+wrapper fades it out.  If level is nil, FadeOutOnExitFrom is FadeOutOnExit.
+*/
+func FadeOutOnExitFrom(
+	duration time.Duration, level func() float64, xft XferFnAtTime,
+) XferFnAtTime {
+	var (
+		exiting   bool
+		exitStart time.Duration
+		fadeFor   time.Duration = duration
+	)
+	return func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (
+		fn gamma.XferFn, sleepFor time.Duration, exit bool,
+	) {
+		var starting bool
+		if e, ok := event.(Exiter); ok && e.IsExit() {
+			if exiting || level == nil {
+				event = nil
+			}
+			if !exiting {
+				exiting = true
+				exitStart = t
+				starting = true
+			}
+		}
+		fn, sleepFor, exit = xft(t, baseFn, event)
+		if exit || !exiting {
+			return
+		}
+		if starting && level != nil {
+			l := math.Max(math.Min(level(), 1), 0)
+			fadeFor = time.Duration(l * float64(duration))
+		}
+		if fadeFor <= 0 || t-exitStart >= fadeFor {
+			return baseFn, 0, true
+		}
+		fn = fn.Blend(baseFn, float64(t-exitStart)/float64(fadeFor))
+		return fn, 0, false
+	}
+}
+
 // Animate starts a goroutine that uses XfterFnAtTime xft to update gamma.Client
 // cl's CRTC lookup tables.  It returns (<-chan error) e, to which exactly one
 // error (or nil) will be written when the animation exits; EventChan ev,
 // through which events may be sent to xft; and CancelFunc c, which may be used
 // to cancel a running animation.
 //
+// The animation holds cl (see gamma.Client.Hold): if cl is closed while the
+// animation is running, the animation exits, restoring the lookup tables if
+// RestoreOnExit allows, and e receives gamma.ErrClientClosed; then cl.Close
+// returns.  If cl is already closed, e receives an error wrapping
+// gamma.ErrClientClosed.
+//
 // NOTE: Once a value has been received on e, Animate will clear any
 // outstanding sends on ev and close it.  Code that sends on ev *concurrently*
 // with a receive on e will work fine, but code that sends on ev *after* a
@@ -149,22 +448,10 @@ func Animate(
 ) {
 	err := make(chan error)
 	cancel := make(chan struct{})
-	o := options{
-		cl:            cl,
-		xft:           xft,
-		err:           err,
-		cancel:        cancel,
-		event:         make(chan interface{}),
-
-		startClockBeforeSetup: false,
-		initialClock:          0,
-		updateInterval:        time.Second / 30,
-		exitOnForeignUpdate:   true,
-		restoreOnExit:         true,
-	}
-	for _, fn := range opts {
-		fn(&o)
-	}
+	o := newOptions(cl, xft, opts)
+	o.err = err
+	o.cancel = cancel
+	o.event = make(chan interface{})
 	e = (<-chan error)(err)
 	c = func() CancelFunc {
 		var called bool
@@ -181,10 +468,65 @@ func Animate(
 	return
 }
 
+/*
+Run is like Animate, but it runs the animation in the calling goroutine and
+returns the animation's error (or nil) when it exits.  Since there's no
+CancelFunc or EventChan, pass a Context Option to make the animation
+cancellable; an animation run by Run receives only nil events.
+*/
+func Run(cl *gamma.Client, xft XferFnAtTime, opts ...Option) error {
+	return run(newOptions(cl, xft, opts))
+}
+
+func newOptions(cl *gamma.Client, xft XferFnAtTime, opts []Option) options {
+	o := options{
+		cl:  cl,
+		xft: xft,
+
+		startClockBeforeSetup: false,
+		initialClock:          0,
+		updateInterval:        time.Second / 30,
+		exitOnForeignUpdate:   true,
+		restoreOnExit:         true,
+		maxFrames:             0,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// animate runs the animation and delivers its error to o.err.
 func animate(o options) {
+	err := run(o)
+	// Drain o.event until o.err has been read.
+	for sent := false; !sent; {
+		select {
+		case o.err <- err:
+			sent = true
+		case <-o.event:
+		}
+	}
+	close(o.err)
+	// Drain o.event until there are no more blocked writers.
+	for drained := false; !drained; {
+		select {
+		case <-o.event:
+		default:
+			drained = true
+		}
+	}
+	close(o.event)
+}
+
+// run runs the animation in the calling goroutine.  o.cancel and o.event may
+// be nil.
+func run(o options) error {
 	var (
 		s          *gamma.Session
 		exit       bool
+		changed    bool
+		frames     int
 		err        error
 		anchor     time.Time
 		thisUpdate time.Time
@@ -197,11 +539,36 @@ func animate(o options) {
 		curFn      gamma.XferFn
 		timer      *time.Timer = time.NewTimer(time.Second)
 		event      interface{}
+		sigChan    chan os.Signal
+		sig        os.Signal
+		pending    interface{}
+		ticker     *time.Ticker
+		interval   time.Duration = o.updateInterval
+		clock      time.Duration
+		reload     bool
+		tolerate   bool = o.skipInitialRead && o.initialBase != nil
+		ctxDone    <-chan struct{}
+		closing    <-chan struct{}
+		release    func()
 	)
 
 	if !timer.Stop() {
 		<-timer.C
 	}
+	if o.ctx != nil {
+		ctxDone = o.ctx.Done()
+	}
+	if len(o.restoreSignals) > 0 {
+		sigChan = make(chan os.Signal, 1)
+		signal.Notify(sigChan, o.restoreSignals...)
+		defer signal.Stop(sigChan)
+	}
+	// Hold the Client so that closing it stops the animation instead of
+	// pulling the display out from under it.
+	if closing, release, err = o.cl.Hold(); err != nil {
+		return err
+	}
+	defer release()
 	if o.startClockBeforeSetup {
 		anchor = time.Now().Add(-o.initialClock)
 		s, err = o.cl.NewSession()
@@ -210,81 +577,177 @@ func animate(o options) {
 		anchor = time.Now().Add(-o.initialClock)
 	}
 	if err != nil {
-		goto bail
+		return err
 	}
 	defer s.Close()
+	if o.fixedCadence {
+		ticker = time.NewTicker(interval)
+		// ticker may be replaced; see UpdateIntervalFunc.
+		defer func() { ticker.Stop() }()
+	}
 
 loop:
 	for {
 		if exit {
 			break loop
 		}
-		if newLut, err = s.GetLookupTable(); err != nil {
-			break loop
-		}
-		if oldLut.IsZero() {
+		if frames == 0 && tolerate {
+			baseFn = o.initialBase
+		} else if frames > 0 && oldLut.IsZero() && !reload {
+			// The last read failed (see SkipInitialRead), so
+			// there's no baseline to detect foreign updates against.
+			changed = false
+		} else if changed, newLut, err = s.ForeignUpdateSince(oldLut); err != nil {
+			if !tolerate {
+				break loop
+			}
+			changed, reload, err = false, false, nil
+		} else if reload {
 			baseFn = newLut.XferFn()
+			reload = false
+		} else if oldLut.IsZero() {
+			if o.initialBase != nil {
+				baseFn = o.initialBase
+			} else {
+				baseFn = newLut.XferFn()
+			}
+		} else if changed {
+			if o.exitOnForeignUpdate {
+				err = ForeignCrtcUpdate
+				o.restoreOnExit = false
+				break loop
+			} else {
+				if o.onForeignUpdate != nil {
+					o.onForeignUpdate(oldLut, newLut)
+				}
+				baseFn = newLut.XferFn()
+			}
+		}
+		if frames == 0 && o.warmupFrame {
+			if err = s.SetGammaSync(baseFn); err != nil {
+				break loop
+			}
+		}
+		clock = time.Now().Sub(anchor)
+		curFn, sleepFor, exit = o.xft(clock, baseFn, event)
+		programmed := true
+		if frames == 0 || changed {
+			// The Session's record of what it last programmed is
+			// stale, so program the CRTCs unconditionally.
+			s.SetGamma(curFn)
 		} else {
-			if !newLut.Equals(oldLut) {
-				if o.exitOnForeignUpdate {
-					err = ForeignCrtcUpdate
-					o.restoreOnExit = false
+			programmed = s.SetGammaIfChanged(curFn, o.changeTolerance)
+		}
+		// If nothing was programmed, oldLut is still current.
+		if programmed {
+			if oldLut, err = s.GetLookupTable(); err != nil {
+				if !tolerate {
 					break loop
-				} else {
-					baseFn = newLut.XferFn()
 				}
+				oldLut, err = gamma.LookupTable{}, nil
 			}
 		}
-		curFn, sleepFor, exit = o.xft(
-			time.Now().Sub(anchor), baseFn, event)
-		s.SetGamma(curFn)
-		if oldLut, err = s.GetLookupTable(); err != nil {
+		if frames++; o.maxFrames > 0 && frames >= o.maxFrames {
 			break loop
 		}
+		if o.updateIntervalFn != nil {
+			next := o.updateIntervalFn(clock)
+			if next <= 0 {
+				next = o.updateInterval
+			}
+			if o.fixedCadence && next != interval {
+				ticker.Stop()
+				ticker = time.NewTicker(next)
+			}
+			interval = next
+		}
 		thisUpdate = time.Now()
-		extraTime = o.updateInterval - thisUpdate.Sub(lastUpdate)
+		extraTime = interval - thisUpdate.Sub(lastUpdate)
 		lastUpdate = thisUpdate
 
-		if sleepFor < extraTime {
+		if sleepFor < extraTime && !o.fixedCadence {
 			sleepFor = extraTime
 		}
 		if sleepFor < 0 {
 			sleepFor = 0
 		}
-		timer.Reset(sleepFor)
 
 		event = nil
-		select {
-		case <-o.cancel:
-			break loop
-		case event = <-o.event:
-			if !timer.Stop() {
-				<-timer.C
+		events := o.event
+		if pending != nil {
+			// Deliver the event that couldn't be coalesced at the
+			// next update, as though it had just been received.
+			events = nil
+			sleepFor = 0
+			if !o.fixedCadence && extraTime > 0 {
+				sleepFor = extraTime
+			}
+		}
+		if o.fixedCadence {
+			wake := time.Now().Add(sleepFor)
+		tick:
+			for {
+				select {
+				case <-o.cancel:
+					break loop
+				case <-ctxDone:
+					break loop
+				case <-closing:
+					err = gamma.ErrClientClosed
+					break loop
+				case sig = <-sigChan:
+					break loop
+				case event = <-events:
+					break tick
+				case now := <-ticker.C:
+					if !now.Before(wake) {
+						break tick
+					}
+				}
+			}
+		} else {
+			timer.Reset(sleepFor)
+			select {
+			case <-o.cancel:
+				break loop
+			case <-ctxDone:
+				break loop
+			case <-closing:
+				err = gamma.ErrClientClosed
+				break loop
+			case sig = <-sigChan:
+				break loop
+			case event = <-events:
+				if !timer.Stop() {
+					<-timer.C
+				}
+			case <-timer.C:
 			}
-		case <-timer.C:
+		}
+		if pending != nil {
+			event, pending = pending, nil
+		}
+		if event != nil && o.coalesceEvents != nil {
+			event, pending = coalesceEvents(o, event)
+		}
+		if _, ok := event.(ReloadBase); ok {
+			reload = true
+			event = nil
 		}
 	}
 
-	if o.restoreOnExit {
+	// baseFn is nil if the initial read failed.
+	if o.restoreOnExit && baseFn != nil {
 		s.SetGamma(baseFn)
 	}
-bail:
-	// Drain o.event until o.err has been read.
-	for {
-		select {
-		case o.err <- err:
-			break
-		case <-o.event:
-		}
-	}
-	close(o.err)
-	// Drain o.event until there are no more blocked writers.
-	for {
-		select {
-		case <-o.event:
-		default:
-			break
+	if sig != nil {
+		// Make a round trip to the X server so that the restore is
+		// flushed before the signal (most likely) terminates us.
+		s.GetLookupTable()
+		signal.Stop(sigChan)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(sig)
 		}
 	}
-	close(o.event)
+	return err
 }
@@ -0,0 +1,594 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package animate
+
+import (
+	"context"
+	"errors"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"testing"
+	"time"
+)
+
+// black is an XferFnAtTime that blacks out the screen until it receives a
+// non-nil event, which it records.
+type black struct {
+	events []interface{}
+}
+
+func (b *black) xft(
+	t time.Duration, baseFn gamma.XferFn, event interface{},
+) (
+	fn gamma.XferFn, sleepFor time.Duration, exit bool,
+) {
+	if event != nil {
+		b.events = append(b.events, event)
+	}
+	return gamma.DimFn(0), time.Second, false
+}
+
+func TestFadeOutOnExit(t *testing.T) {
+	var b black
+	xft := FadeOutOnExit(time.Second, b.xft)
+	base := gamma.IdentityFn()
+
+	fn, sleepFor, exit := xft(0, base, "hello")
+	if fn(gamma.Red, 1) != 0 || sleepFor != time.Second || exit {
+		t.Fatal("FadeOutOnExit altered the output before an exit event")
+	}
+	fn, sleepFor, exit = xft(time.Second, base, ExitEvent{})
+	if fn(gamma.Red, 1) != 0 || sleepFor != 0 || exit {
+		t.Fatal("the fade-out did not start from the child's output")
+	}
+	fn, _, exit = xft(1500*time.Millisecond, base, nil)
+	if out := fn(gamma.Red, 1); out < 0.49 || out > 0.51 || exit {
+		t.Fatalf("expected a half-faded output, got %f", out)
+	}
+	fn, _, exit = xft(2*time.Second, base, nil)
+	if fn(gamma.Red, 1) != 1 || !exit {
+		t.Fatal("the animation did not exit after the fade-out")
+	}
+	if len(b.events) != 1 || b.events[0] != "hello" {
+		t.Fatalf("unexpected events passed through: %v", b.events)
+	}
+}
+
+func TestFadeOutOnExitFrom(t *testing.T) {
+	var b black
+	level := func() float64 { return 0.5 }
+	xft := FadeOutOnExitFrom(time.Second, level, b.xft)
+	base := gamma.IdentityFn()
+
+	fn, _, exit := xft(time.Second, base, ExitEvent{})
+	if fn(gamma.Red, 1) != 0 || exit {
+		t.Fatal("the fade-out did not start from the child's output")
+	}
+	// From half strength, the fade-out takes half the duration.
+	fn, _, exit = xft(1250*time.Millisecond, base, ExitEvent{})
+	if out := fn(gamma.Red, 1); out < 0.49 || out > 0.51 || exit {
+		t.Fatalf("expected a half-faded output, got %f", out)
+	}
+	fn, _, exit = xft(1500*time.Millisecond, base, nil)
+	if fn(gamma.Red, 1) != 1 || !exit {
+		t.Fatal("the animation did not exit after the fade-out")
+	}
+	if len(b.events) != 1 || b.events[0] != (ExitEvent{}) {
+		t.Fatalf("expected only the first exit event to pass through, "+
+			"got %v", b.events)
+	}
+}
+
+// constant returns an XferFnAtTime that scales baseFn's output by coef.
+func constant(coef float64) XferFnAtTime {
+	return func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (
+		fn gamma.XferFn, sleepFor time.Duration, exit bool,
+	) {
+		return baseFn.Chain(gamma.DimFn(coef)), time.Second, false
+	}
+}
+
+func TestMixer(t *testing.T) {
+	xft := mixer()
+	base := gamma.IdentityFn()
+	var b black
+
+	fn, _, _ := xft(0, base, nil)
+	if fn(gamma.Red, 1) != 1 {
+		t.Fatal("an empty mixer altered baseFn")
+	}
+	xft(0, base, mixerAdd{"half", 1, constant(0.5)})
+	xft(0, base, mixerAdd{"black", 2, b.xft})
+	fn, _, _ = xft(0, base, mixerAdd{"quarter", 0, constant(0.25)})
+	if out := fn(gamma.Red, 1); out != 0 {
+		t.Fatalf("expected the top layer to black out, got %f", out)
+	}
+	xft(0, base, mixerEvent{"black", "hello"})
+	if len(b.events) != 1 {
+		t.Fatal("the event was not routed to its layer")
+	}
+	fn, sleepFor, _ := xft(time.Second, base, mixerRemove{"black", time.Second})
+	if out := fn(gamma.Red, 1); out != 0 || sleepFor != 0 {
+		t.Fatal("the removed layer did not start fading from its output")
+	}
+	fn, _, _ = xft(2*time.Second, base, nil)
+	if out := fn(gamma.Red, 1); out != 0.125 {
+		t.Fatalf("expected the remaining layers to compose, got %f", out)
+	}
+}
+
+// mergeEqual is a CoalesceEvents function that merges equal events.
+func mergeEqual(a, b interface{}) (interface{}, bool) {
+	if a == b {
+		return a, true
+	}
+	return nil, false
+}
+
+func TestCoalesceEvents(t *testing.T) {
+	// A buffered channel's events are ready to receive as soon as
+	// they're sent, like those of blocked senders.
+	o := options{
+		event:          make(chan interface{}, 4),
+		coalesceEvents: mergeEqual,
+	}
+	send := func(events ...string) {
+		for _, event := range events {
+			o.event <- event
+		}
+	}
+
+	send("strobe", "strobe", "strobe")
+	merged, pending := coalesceEvents(o, <-o.event)
+	if merged != "strobe" || pending != nil {
+		t.Fatalf("unexpected coalescing: %v, %v", merged, pending)
+	}
+	send("strobe", "warble")
+	merged, pending = coalesceEvents(o, <-o.event)
+	if merged == pending || pending == nil {
+		t.Fatalf("unexpected coalescing: %v, %v", merged, pending)
+	}
+}
+
+func TestCoalesceEventsPending(t *testing.T) {
+	cl, _ := newFakeClient(t)
+	defer cl.Close()
+	var events []interface{}
+	xft := func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (gamma.XferFn, time.Duration, bool) {
+		events = append(events, event)
+		return baseFn, time.Hour, false
+	}
+	// withEvents returns options whose EventChan already holds events
+	// that can't all be coalesced.
+	withEvents := func(opts ...Option) options {
+		o := newOptions(cl, xft, append(opts, CoalesceEvents(mergeEqual),
+			UpdateInterval(50*time.Millisecond)))
+		o.cancel = make(chan struct{})
+		o.event = make(chan interface{}, 4)
+		o.event <- "strobe"
+		o.event <- "warble"
+		o.event <- "strobe"
+		return o
+	}
+
+	// Events that couldn't be coalesced are still paced by the update
+	// interval.
+	start := time.Now()
+	if err := run(withEvents(MaxFrames(4))); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Fatalf("expected the pending events to be paced, took %v",
+			elapsed)
+	}
+	if len(events) != 4 || events[1] != "strobe" ||
+		events[2] != "warble" || events[3] != "strobe" {
+		t.Fatalf("unexpected events: %v", events)
+	}
+
+	// A pending event doesn't delay cancellation.
+	events = nil
+	o := withEvents()
+	o.xft = func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (gamma.XferFn, time.Duration, bool) {
+		if event != nil {
+			close(o.cancel)
+		}
+		return xft(t, baseFn, event)
+	}
+	if err := run(o); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected the animation to exit after 2 frames, got %v",
+			events)
+	}
+}
+
+func TestKeyframes(t *testing.T) {
+	xft := Keyframes([]Keyframe{
+		{At: 2 * time.Second, Fn: gamma.DimFn(0.5)},
+		{At: time.Second, Fn: nil},
+		{At: 3 * time.Second, Fn: gamma.DimFn(0)},
+	})
+	base := gamma.IdentityFn()
+	for _, c := range []struct {
+		t    time.Duration
+		want float64
+		exit bool
+	}{
+		{0, 1, false},
+		{1500 * time.Millisecond, 0.75, false},
+		{2500 * time.Millisecond, 0.25, false},
+		{3 * time.Second, 0, true},
+	} {
+		fn, _, exit := xft(c.t, base, nil)
+		if out := fn(gamma.Blue, 1); out < c.want-1e-9 ||
+			out > c.want+1e-9 || exit != c.exit {
+			t.Fatalf("at %v: expected (%g, %v), got (%g, %v)",
+				c.t, c.want, c.exit, out, exit)
+		}
+	}
+}
+
+func TestTransitioner(t *testing.T) {
+	xft := Transitioner(gamma.IdentityFn(), time.Second)
+	base := gamma.IdentityFn()
+	near := func(a, b float64) bool { return a > b-1e-3 && a < b+1e-3 }
+
+	fn, _, _ := xft(0, base, nil)
+	if fn(gamma.Red, 1) != 1 {
+		t.Fatal("Transitioner didn't start with defaultFn")
+	}
+	xft(time.Second, base, gamma.DimFn(0))
+	fn, sleepFor, _ := xft(1500*time.Millisecond, base, nil)
+	if out := fn(gamma.Red, 1); !near(out, 0.5) || sleepFor != 0 {
+		t.Fatalf("expected a half-finished transition, got %f", out)
+	}
+	// Interrupt the transition; the new one starts where it left off.
+	fn, _, _ = xft(1500*time.Millisecond, base, gamma.IdentityFn())
+	if out := fn(gamma.Red, 1); !near(out, 0.5) {
+		t.Fatalf("the interrupted transition jumped to %f", out)
+	}
+	fn, _, _ = xft(2*time.Second, base, nil)
+	if out := fn(gamma.Red, 1); !near(out, 0.75) {
+		t.Fatalf("expected a half-finished transition, got %f", out)
+	}
+	fn, sleepFor, exit := xft(3*time.Second, base, "ignored")
+	if out := fn(gamma.Red, 1); out != 1 || sleepFor == 0 || exit {
+		t.Fatalf("unexpected final state: %f, %v, %v", out, sleepFor,
+			exit)
+	}
+}
+
+func TestRender(t *testing.T) {
+	xft := Keyframes([]Keyframe{
+		{At: 0, Fn: nil},
+		{At: time.Second, Fn: gamma.DimFn(0)},
+	})
+	frames := Render(xft, gamma.IdentityFn(), time.Hour,
+		250*time.Millisecond, 4)
+	if len(frames) != 5 {
+		t.Fatalf("expected the animation to exit after 5 frames, got %d",
+			len(frames))
+	}
+	if v := frames[2][gamma.Green][2]; v != 16384 {
+		t.Fatalf("expected a half-dimmed frame, got %d", v)
+	}
+	if v := frames[4][gamma.Blue][3]; v != 0 {
+		t.Fatalf("expected a black final frame, got %d", v)
+	}
+
+	frames = Render(constant(1), gamma.IdentityFn(), time.Second,
+		300*time.Millisecond, 4)
+	if len(frames) != 4 {
+		t.Fatalf("expected 4 frames within the duration, got %d",
+			len(frames))
+	}
+}
+
+// newFakeClient returns a fake Client with one CRTC, whose lookup table has 4
+// entries.
+func newFakeClient(t *testing.T) (*gamma.Client, *gamma.FakeDisplay) {
+	cl, d, err := gamma.NewFakeClient(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cl, d
+}
+
+// recorder is an XferFnAtTime that passes baseFn through, sleeping for
+// sleepFor, and records the clock and baseFn of each frame.  If hook is set,
+// it's called at the start of each frame with the frame's index.
+type recorder struct {
+	sleepFor time.Duration
+	hook     func(frame int)
+	clocks   []time.Duration
+	bases    []gamma.XferFn
+}
+
+func (r *recorder) xft(
+	t time.Duration, baseFn gamma.XferFn, event interface{},
+) (
+	fn gamma.XferFn, sleepFor time.Duration, exit bool,
+) {
+	if r.hook != nil {
+		r.hook(len(r.clocks))
+	}
+	r.clocks = append(r.clocks, t)
+	r.bases = append(r.bases, baseFn)
+	return baseFn, r.sleepFor, false
+}
+
+func TestRunMaxFrames(t *testing.T) {
+	cl, _ := newFakeClient(t)
+	defer cl.Close()
+	var r recorder
+	if err := Run(cl, r.xft, MaxFrames(3),
+		UpdateInterval(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.clocks) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(r.clocks))
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	cl, d := newFakeClient(t)
+	defer cl.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	frames := 0
+	xft := func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (gamma.XferFn, time.Duration, bool) {
+		frames++
+		return gamma.DimFn(0), time.Hour, false
+	}
+	if err := Run(cl, xft, Context(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	if frames != 1 {
+		t.Fatalf("expected 1 frame, got %d", frames)
+	}
+	if v := d.Ramp(0, gamma.Red)[3]; v != 65535 {
+		t.Fatalf("expected baseFn to be restored, got %d", v)
+	}
+}
+
+func TestForeignUpdate(t *testing.T) {
+	black := []uint16{0, 0, 0, 0}
+	cl, d := newFakeClient(t)
+	defer cl.Close()
+	// The passed-through frames are unchanged, so the foreign update made
+	// during frame 1 isn't overwritten, and frame 2 detects it.
+	r := recorder{hook: func(frame int) {
+		if frame == 1 {
+			d.SetRamp(0, gamma.Green, black)
+		}
+	}}
+	err := Run(cl, r.xft, UpdateInterval(time.Millisecond))
+	if err != ForeignCrtcUpdate {
+		t.Fatalf("expected ForeignCrtcUpdate, got %v", err)
+	}
+	if len(r.clocks) != 2 {
+		t.Fatalf("expected the animation to exit after 2 frames, got %d",
+			len(r.clocks))
+	}
+	if v := d.Ramp(0, gamma.Green)[3]; v != 0 {
+		t.Fatalf("expected the foreign update to be kept, got %d", v)
+	}
+
+	cl, d = newFakeClient(t)
+	defer cl.Close()
+	var olds, news []gamma.LookupTable
+	r = recorder{hook: r.hook}
+	if err = Run(cl, r.xft, UpdateInterval(time.Millisecond),
+		MaxFrames(3), ExitOnForeignUpdate(false),
+		OnForeignUpdate(func(old, new gamma.LookupTable) {
+			olds = append(olds, old)
+			news = append(news, new)
+		})); err != nil {
+		t.Fatal(err)
+	}
+	if len(olds) != 1 || olds[0].Channel(gamma.Green)[3] != 65535 ||
+		news[0].Channel(gamma.Green)[3] != 0 {
+		t.Fatalf("unexpected OnForeignUpdate calls: %v, %v", olds, news)
+	}
+	if out := r.bases[2](gamma.Green, 1); out != 0 {
+		t.Fatalf("expected baseFn to absorb the update, got %f", out)
+	}
+	if out := r.bases[2](gamma.Red, 1); out != 1 {
+		t.Fatalf("expected baseFn to keep red, got %f", out)
+	}
+}
+
+func TestReloadBase(t *testing.T) {
+	cl, d := newFakeClient(t)
+	defer cl.Close()
+	bases := make(chan gamma.XferFn, 8)
+	events := make(chan interface{}, 8)
+	xft := func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (gamma.XferFn, time.Duration, bool) {
+		bases <- baseFn
+		events <- event
+		return baseFn, time.Hour, false
+	}
+	e, ev, cancel := Animate(cl, xft)
+	<-bases
+	<-events
+	// Once frame 1 has begun, the animation has checked for foreign
+	// updates and won't program its unchanged frame.
+	ev <- "sync"
+	<-bases
+	<-events
+	d.SetRamp(0, gamma.Green, []uint16{0, 0, 0, 0})
+	ev <- ReloadBase{}
+	baseFn := <-bases
+	if event := <-events; event != nil {
+		t.Fatalf("expected ReloadBase to be consumed, got %v", event)
+	}
+	if out := baseFn(gamma.Green, 1); out != 0 {
+		t.Fatalf("expected baseFn to be reloaded, got %f", out)
+	}
+	cancel()
+	if err := <-e; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFixedCadence(t *testing.T) {
+	cl, _ := newFakeClient(t)
+	defer cl.Close()
+	// Each sleep is rounded up to the next 20ms tick, so the frames are
+	// 40ms apart rather than 30ms.
+	r := recorder{sleepFor: 30 * time.Millisecond}
+	if err := Run(cl, r.xft, MaxFrames(4), FixedCadence(true),
+		UpdateInterval(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if r.clocks[3]-r.clocks[0] < 110*time.Millisecond {
+		t.Fatalf("expected frames on the 20ms grid, got %v", r.clocks)
+	}
+}
+
+func TestChangeTolerance(t *testing.T) {
+	// The two XferFns differ by 1 in the last value of each ramp.
+	fns := []gamma.XferFn{gamma.IdentityFn(), gamma.DimFn(0.99999)}
+	for _, c := range []struct {
+		tolerance uint16
+		want      int
+	}{
+		{0, 4},
+		{1, 1},
+	} {
+		cl, d := newFakeClient(t)
+		frames := 0
+		xft := func(
+			t time.Duration, baseFn gamma.XferFn, event interface{},
+		) (gamma.XferFn, time.Duration, bool) {
+			frames++
+			return fns[frames%2], 0, false
+		}
+		err := Run(cl, xft, MaxFrames(4), RestoreOnExit(false),
+			UpdateInterval(time.Millisecond),
+			ChangeTolerance(c.tolerance))
+		if sets := d.Sets(); err != nil || sets != c.want {
+			t.Fatalf("tolerance %d: expected %d sets, got %d (%v)",
+				c.tolerance, c.want, sets, err)
+		}
+		// Frames that weren't programmed still count toward
+		// MaxFrames.
+		if frames != 4 {
+			t.Fatalf("tolerance %d: expected 4 frames, got %d",
+				c.tolerance, frames)
+		}
+		cl.Close()
+	}
+}
+
+func TestUpdateIntervalFunc(t *testing.T) {
+	for _, fixed := range []bool{false, true} {
+		cl, _ := newFakeClient(t)
+		// If the function were ignored, the animation would run until
+		// the Context's deadline.
+		ctx, cancel := context.WithTimeout(context.Background(),
+			5*time.Second)
+		var r recorder
+		err := Run(cl, r.xft, MaxFrames(3), Context(ctx),
+			FixedCadence(fixed), UpdateInterval(time.Hour),
+			UpdateIntervalFunc(func(time.Duration) time.Duration {
+				return time.Millisecond
+			}))
+		cancel()
+		cl.Close()
+		if err != nil || len(r.clocks) != 3 {
+			t.Fatalf("FixedCadence(%v): expected 3 frames, "+
+				"got %d (%v)", fixed, len(r.clocks), err)
+		}
+	}
+}
+
+func TestWarmupFrame(t *testing.T) {
+	base := gamma.DimFn(0.5)
+	for _, warmup := range []bool{false, true} {
+		cl, d := newFakeClient(t)
+		var sets int
+		var ramp []uint16
+		r := recorder{hook: func(frame int) {
+			if frame == 0 {
+				sets, ramp = d.Sets(), d.Ramp(0, gamma.Red)
+			}
+		}}
+		err := Run(cl, r.xft, MaxFrames(1), InitialBase(base),
+			WarmupFrame(warmup))
+		cl.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !warmup {
+			if sets != 0 {
+				t.Fatalf("expected no warm-up frame, got %d sets",
+					sets)
+			}
+			continue
+		}
+		if want := gamma.EvaluateRamp(base, gamma.Red, 4); sets != 1 ||
+			ramp[3] != want[3] {
+			t.Fatalf("expected a warm-up frame of %v, "+
+				"got %v (%d sets)", want, ramp, sets)
+		}
+	}
+}
+
+func TestSkipInitialRead(t *testing.T) {
+	cl, d := newFakeClient(t)
+	defer cl.Close()
+	// Without the initial read, a foreign update made before the first
+	// frame goes unnoticed.
+	d.SetRamp(0, gamma.Green, []uint16{0, 0, 0, 0})
+	var r recorder
+	if err := Run(cl, r.xft, MaxFrames(2), InitialBase(gamma.IdentityFn()),
+		SkipInitialRead(true),
+		UpdateInterval(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if out := r.bases[1](gamma.Green, 1); out != 1 {
+		t.Fatalf("expected InitialBase to be kept, got %f", out)
+	}
+
+	// Nor do failed reads end the animation.
+	d.FailReads(true)
+	r = recorder{}
+	if err := Run(cl, r.xft, MaxFrames(3), InitialBase(gamma.IdentityFn()),
+		SkipInitialRead(true),
+		UpdateInterval(time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.clocks) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(r.clocks))
+	}
+	err := Run(cl, r.xft, InitialBase(gamma.IdentityFn()))
+	if !errors.Is(err, gamma.ErrCrtcRead) {
+		t.Fatalf("expected ErrCrtcRead without SkipInitialRead, got %v",
+			err)
+	}
+}
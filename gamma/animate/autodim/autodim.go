@@ -0,0 +1,142 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package autodim provides Xft, an event-responsive animate.XferFnAtTime that
+// progressively dims the screen once the user has been idle for a while and
+// brightens it immediately on activity, and ScreenSaverIdle, an idle-time
+// source backed by the MIT-SCREEN-SAVER extension.
+package autodim
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"github.com/branen/go-xrr-gamma/gamma/animate"
+	"math"
+	"time"
+)
+
+// Cmd specifies a command for a running autodim animation.
+type Cmd int
+
+const (
+	noCmd Cmd = iota
+	// Reports user activity, brightening the screen immediately, even if
+	// the IdleFunc hasn't noticed the activity yet.
+	Activity
+)
+
+// IdleFunc returns the amount of time for which the user has been idle.
+type IdleFunc func() (time.Duration, error)
+
+type options struct {
+	threshold    time.Duration
+	rampDuration time.Duration
+	level        float64
+	pollInterval time.Duration
+}
+
+// Option configures an autodim animation created by Xft.
+type Option func(o *options)
+
+// Threshold sets how long the user must be idle before the screen begins to
+// dim.  By default, the threshold is five minutes.
+func Threshold(d time.Duration) Option {
+	return func(o *options) {
+		o.threshold = d
+	}
+}
+
+// RampDuration sets how long the screen takes to dim fully once the threshold
+// has been reached.  By default, the ramp lasts ten seconds.
+func RampDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.rampDuration = d
+	}
+}
+
+// Level sets the DimFn coefficient reached at the end of the ramp.  By
+// default, the screen is dimmed to 0.5.
+func Level(coef float64) Option {
+	return func(o *options) {
+		o.level = coef
+	}
+}
+
+// PollInterval sets how often the IdleFunc is polled for activity while the
+// screen is dimmed.  By default, it's polled every 250ms.
+func PollInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.pollInterval = d
+	}
+}
+
+/*
+Xft returns an animate.XferFnAtTime instance that dims the screen when the idle
+time reported by idle exceeds a threshold and accepts events of type Cmd
+through animate.Animate's EventChan.
+
+The animation never exits on its own; cancel it with animate.CancelFunc.  If
+idle returns an error, the user is treated as active.
+*/
+func Xft(idle IdleFunc, opts ...Option) animate.XferFnAtTime {
+	o := options{
+		threshold:    5 * time.Minute,
+		rampDuration: 10 * time.Second,
+		level:        0.5,
+		pollInterval: 250 * time.Millisecond,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	var (
+		activeAt time.Duration
+		idleFor  time.Duration
+		strength float64
+		err      error
+	)
+
+	return func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (
+		fn gamma.XferFn, sleepFor time.Duration, exit bool,
+	) {
+		if cmd, ok := event.(Cmd); ok && cmd == Activity {
+			activeAt = t
+		}
+		if idleFor, err = idle(); err != nil {
+			idleFor = 0
+		}
+		if sinceActive := t - activeAt; sinceActive < idleFor {
+			idleFor = sinceActive
+		}
+
+		switch {
+		case idleFor < o.threshold:
+			strength = 0
+			sleepFor = o.threshold - idleFor
+		case o.rampDuration <= 0 ||
+			idleFor >= o.threshold+o.rampDuration:
+			strength = 1
+			sleepFor = o.pollInterval
+		default:
+			strength = float64(idleFor-o.threshold) /
+				float64(o.rampDuration)
+			sleepFor = 0
+		}
+
+		coef := 1 - strength*(1-math.Max(math.Min(o.level, 1), 0))
+		fn = baseFn.Chain(gamma.DimFn(coef))
+		return
+	}
+}
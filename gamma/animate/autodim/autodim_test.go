@@ -0,0 +1,66 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package autodim
+
+import (
+	"fmt"
+	"github.com/branen/go-xrr-gamma/gamma"
+	"testing"
+	"time"
+)
+
+func TestXft(t *testing.T) {
+	var (
+		idleFor time.Duration
+		idleErr error
+	)
+	idle := func() (time.Duration, error) { return idleFor, idleErr }
+	xft := Xft(idle, Threshold(time.Minute), RampDuration(10*time.Second),
+		Level(0.2), PollInterval(time.Second))
+	base := gamma.PowerFn(2)
+
+	for _, c := range []struct {
+		t, idleFor time.Duration
+		event      interface{}
+		want       float64
+		sleepFor   time.Duration
+	}{
+		{0, 0, nil, 1, time.Minute},
+		{20 * time.Second, 20 * time.Second, nil, 1, 40 * time.Second},
+		{65 * time.Second, 65 * time.Second, nil, 0.6, 0},
+		{75 * time.Second, 75 * time.Second, nil, 0.2, time.Second},
+		// Activity brightens the screen before the IdleFunc notices.
+		{80 * time.Second, 80 * time.Second, Activity, 1, time.Minute},
+		{85 * time.Second, 85 * time.Second, nil, 1, 55 * time.Second},
+	} {
+		idleFor = c.idleFor
+		fn, sleepFor, exit := xft(c.t, base, c.event)
+		// The coefficient scales baseFn's output, not its input.
+		want := c.want * 0.25
+		if out := fn(gamma.Red, 0.5); out < want-1e-9 || out > want+1e-9 {
+			t.Fatalf("at %v: expected %g, got %g", c.t, want, out)
+		}
+		if sleepFor != c.sleepFor || exit {
+			t.Fatalf("at %v: expected (%v, false), got (%v, %v)", c.t,
+				c.sleepFor, sleepFor, exit)
+		}
+	}
+
+	idleFor, idleErr = time.Hour, fmt.Errorf("no idle time")
+	if fn, _, _ := xft(time.Hour, base, nil); fn(gamma.Red, 1) != 1 {
+		t.Fatal("an IdleFunc error didn't count as activity")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package autodim_test
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"github.com/branen/go-xrr-gamma/gamma/animate"
+	"github.com/branen/go-xrr-gamma/gamma/animate/autodim"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func Example() {
+	var (
+		cl   *gamma.Client
+		idle *autodim.ScreenSaverIdle
+		err  error
+
+		sigChan    chan os.Signal = make(chan os.Signal, 1)
+		errChan    <-chan error
+		eventChan  animate.EventChan
+		cancelFunc animate.CancelFunc
+	)
+
+	// Connect to XRandR and to the MIT-SCREEN-SAVER extension.
+	if cl, err = gamma.NewClient(); err != nil {
+		log.Fatal(err)
+	}
+	defer cl.Close()
+	if idle, err = autodim.NewScreenSaverIdle(); err != nil {
+		log.Fatal(err)
+	}
+	defer idle.Close()
+
+	// Start the animation goroutine, dimming to 30% after a minute idle.
+	errChan, eventChan, cancelFunc = animate.Animate(cl, autodim.Xft(
+		idle.Idle, autodim.Threshold(time.Minute), autodim.Level(0.3)))
+
+	// Wait and handle signals until the animation goroutine exits.
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGUSR1)
+	for {
+		select {
+		// Exit when the animation goroutine exits.
+		case err, ok := <-errChan:
+			if ok {
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			return
+		case c := <-sigChan:
+			switch c {
+			// Exit the animation via cancelFunc on SIGINT
+			case syscall.SIGINT:
+				cancelFunc()
+			// Treat SIGUSR1 as user activity
+			case syscall.SIGUSR1:
+				eventChan <- autodim.Activity
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package autodim
+
+/*
+#cgo LDFLAGS: -lX11 -lXss
+#include <X11/Xlib.h>
+#include <X11/extensions/scrnsaver.h>
+
+Window GetDefaultRootWindow(Display *dpy) {
+	return DefaultRootWindow(dpy);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+/*
+ScreenSaverIdle queries the user's idle time through the MIT-SCREEN-SAVER
+extension (i.e. XScreenSaverQueryInfo), using its own connection to the X
+display.  Its Idle method may be passed to Xft as an IdleFunc.
+
+ScreenSaverIdle instances must be created by NewScreenSaverIdle--its zero value
+is not valid for use.
+*/
+type ScreenSaverIdle struct {
+	dpy   *C.Display
+	info  *C.XScreenSaverInfo
+	mutex sync.Mutex
+	open  bool
+}
+
+func NewScreenSaverIdle() (ssi *ScreenSaverIdle, err error) {
+	ssi = new(ScreenSaverIdle)
+	if ssi.dpy = C.XOpenDisplay(nil); ssi.dpy == nil {
+		return nil, fmt.Errorf("Could not open X display.")
+	}
+	var eventBase, errorBase C.int
+	if C.XScreenSaverQueryExtension(ssi.dpy, &eventBase, &errorBase) == 0 {
+		C.XCloseDisplay(ssi.dpy)
+		return nil, fmt.Errorf("MIT-SCREEN-SAVER extension not available.")
+	}
+	if ssi.info = C.XScreenSaverAllocInfo(); ssi.info == nil {
+		C.XCloseDisplay(ssi.dpy)
+		return nil, fmt.Errorf("Error allocating XScreenSaverInfo.")
+	}
+	ssi.open = true
+	runtime.SetFinalizer(ssi, func(ssi *ScreenSaverIdle) {
+		ssi.Close()
+	})
+	return
+}
+
+// Idle returns the time since the user's last input.
+func (ssi *ScreenSaverIdle) Idle() (time.Duration, error) {
+	ssi.mutex.Lock()
+	defer ssi.mutex.Unlock()
+	if !ssi.open {
+		return 0, fmt.Errorf("ScreenSaverIdle has already been closed.")
+	}
+	root := C.GetDefaultRootWindow(ssi.dpy)
+	if C.XScreenSaverQueryInfo(ssi.dpy, C.Drawable(root), ssi.info) == 0 {
+		return 0, fmt.Errorf("Error querying XScreenSaverInfo.")
+	}
+	return time.Duration(ssi.info.idle) * time.Millisecond, nil
+}
+
+// Close "closes" a ScreenSaverIdle, releasing its underlying resources.  Once
+// it has been closed, Idle returns an error.
+//
+// Calling Close more than once is a no-op.
+func (ssi *ScreenSaverIdle) Close() {
+	if ssi == nil {
+		return
+	}
+	ssi.mutex.Lock()
+	defer ssi.mutex.Unlock()
+	if !ssi.open {
+		return
+	}
+	C.XFree(unsafe.Pointer(ssi.info))
+	C.XCloseDisplay(ssi.dpy)
+	ssi.open = false
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package ease provides easing functions, which map an animation's linear
+// progress through a transition to a smoother one, so that the transition
+// accelerates and decelerates rather than starting and stopping abruptly.
+package ease
+
+import (
+	"math"
+)
+
+// Func is an easing function.  It maps progress x in [0, 1] to eased progress
+// in [0, 1], with Func(0) = 0 and Func(1) = 1.  Inputs outside [0, 1] are
+// clamped.
+type Func func(x float64) float64
+
+func clamp(x float64) float64 {
+	return math.Max(math.Min(x, 1), 0)
+}
+
+// Linear is the identity easing function; it doesn't ease at all.
+func Linear(x float64) float64 {
+	return clamp(x)
+}
+
+// SineIn starts slowly and ends at full speed, following a quarter sine wave.
+func SineIn(x float64) float64 {
+	return 1 - math.Cos(clamp(x)*math.Pi/2)
+}
+
+// SineOut starts at full speed and ends slowly, following a quarter sine wave.
+func SineOut(x float64) float64 {
+	return math.Sin(clamp(x) * math.Pi / 2)
+}
+
+// SineInOut starts and ends slowly, following half a sine wave.  Its slope is
+// zero at both ends, so transitions eased with it can be joined end-to-end
+// without a visible jerk.
+func SineInOut(x float64) float64 {
+	return (1 - math.Cos(clamp(x)*math.Pi)) / 2
+}
@@ -0,0 +1,45 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ease
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEndpoints(t *testing.T) {
+	for name, fn := range map[string]Func{
+		"Linear":    Linear,
+		"SineIn":    SineIn,
+		"SineOut":   SineOut,
+		"SineInOut": SineInOut,
+	} {
+		if fn(0) != 0 || math.Abs(fn(1)-1) > 1e-12 {
+			t.Fatalf("%s doesn't map 0 to 0 and 1 to 1", name)
+		}
+		if fn(-1) != fn(0) || fn(2) != fn(1) {
+			t.Fatalf("%s doesn't clamp its input", name)
+		}
+		for x := 0.0; x < 1; x += 0.01 {
+			if fn(x+0.01) < fn(x) {
+				t.Fatalf("%s isn't monotonic at %f", name, x)
+			}
+		}
+	}
+	if out := SineInOut(0.5); math.Abs(out-0.5) > 1e-12 {
+		t.Fatalf("expected SineInOut(0.5) = 0.5, got %f", out)
+	}
+}
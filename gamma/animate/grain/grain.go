@@ -0,0 +1,77 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package grain provides Xft, an animate.XferFnAtTime that makes the screen
+// flicker subtly, like film grain, by jittering its brightness at random each
+// frame.
+package grain
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"github.com/branen/go-xrr-gamma/gamma/animate"
+	"math/rand"
+	"time"
+)
+
+type options struct {
+	frameInterval time.Duration
+}
+
+// Option configures a grain animation created by Xft.
+type Option func(o *options)
+
+// FrameInterval sets how often the jitter changes.  By default, it changes
+// every 1/24th of a second, like film.
+func FrameInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.frameInterval = d
+	}
+}
+
+/*
+Xft returns an animate.XferFnAtTime that scales the output of baseFn by a
+random factor in [1-amplitude, 1+amplitude] that changes every frame.  For
+subtle grain, amplitude should be small (e.g. 0.02).
+
+Each frame's factor is derived from the frame's position on the animation
+clock, so an animation restarted with the same clock (see
+animate.InitialClock) flickers identically.  Xft ignores events and never
+exits on its own.
+*/
+func Xft(amplitude float64, opts ...Option) animate.XferFnAtTime {
+	o := options{
+		frameInterval: time.Second / 24,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	if o.frameInterval <= 0 {
+		o.frameInterval = time.Second / 24
+	}
+	return func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (
+		fn gamma.XferFn, sleepFor time.Duration, exit bool,
+	) {
+		frame := int64(t / o.frameInterval)
+		r := rand.New(rand.NewSource(frame))
+		coef := 1 + amplitude*(2*r.Float64()-1)
+		fn = func(ch gamma.Channel, in float64) (out float64) {
+			return baseFn(ch, in) * coef
+		}
+		sleepFor = o.frameInterval - t%o.frameInterval
+		return
+	}
+}
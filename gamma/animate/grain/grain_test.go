@@ -0,0 +1,52 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package grain
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"testing"
+	"time"
+)
+
+func TestXft(t *testing.T) {
+	const amplitude = 0.02
+	xft := Xft(amplitude)
+	base := gamma.DimFn(0.5)
+	varies := false
+	for frame := 0; frame < 48; frame++ {
+		t0 := time.Duration(frame) * time.Second / 24
+		fn, sleepFor, exit := xft(t0, base, nil)
+		out := fn(gamma.Red, 1)
+		if out < 0.5*(1-amplitude) || out > 0.5*(1+amplitude) || exit {
+			t.Fatalf("frame %d: out of bounds: %g", frame, out)
+		}
+		if sleepFor <= 0 || sleepFor > time.Second/24 {
+			t.Fatalf("frame %d: unexpected sleep %v", frame, sleepFor)
+		}
+		// The same clock must produce the same jitter.
+		again, _, _ := xft(t0+time.Millisecond, base, nil)
+		if again(gamma.Red, 1) != out {
+			t.Fatalf("frame %d: jitter isn't reproducible", frame)
+		}
+		first, _, _ := xft(0, base, nil)
+		if out != first(gamma.Red, 1) {
+			varies = true
+		}
+	}
+	if !varies {
+		t.Fatal("the jitter never changed")
+	}
+}
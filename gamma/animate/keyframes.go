@@ -0,0 +1,76 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package animate
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"sort"
+	"time"
+)
+
+// Keyframe specifies the XferFn that a Keyframes animation applies at a given
+// point on its clock.  Fn is applied to the output of the animation's baseFn;
+// a nil Fn leaves baseFn unchanged.
+type Keyframe struct {
+	At time.Duration
+	Fn gamma.XferFn
+}
+
+/*
+Keyframes returns an XferFnAtTime that blends between keyframes according to
+the animation clock: between two adjacent keyframes, their XferFns are blended
+linearly (see gamma.XferFn.Blend) by the fraction of the interval that has
+elapsed.  Before the first keyframe, the first keyframe's XferFn is applied.
+The animation exits when the clock reaches the last keyframe.
+
+The keyframes needn't be sorted.  Keyframes ignores events.
+*/
+func Keyframes(keyframes []Keyframe) XferFnAtTime {
+	kfs := append([]Keyframe(nil), keyframes...)
+	sort.SliceStable(kfs, func(i, j int) bool {
+		return kfs[i].At < kfs[j].At
+	})
+	apply := func(baseFn gamma.XferFn, kf Keyframe) gamma.XferFn {
+		if kf.Fn == nil {
+			return baseFn
+		}
+		return baseFn.Chain(kf.Fn)
+	}
+	return func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (
+		fn gamma.XferFn, sleepFor time.Duration, exit bool,
+	) {
+		if len(kfs) == 0 {
+			return baseFn, 0, true
+		}
+		last := kfs[len(kfs)-1]
+		if t >= last.At {
+			return apply(baseFn, last), 0, true
+		}
+		// next is the first keyframe after t.
+		next := sort.Search(len(kfs), func(i int) bool {
+			return kfs[i].At > t
+		})
+		if next == 0 {
+			return apply(baseFn, kfs[0]), kfs[0].At - t, false
+		}
+		from, to := kfs[next-1], kfs[next]
+		weight := float64(t-from.At) / float64(to.At-from.At)
+		fn = apply(baseFn, from).Blend(apply(baseFn, to), weight)
+		return fn, 0, false
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package animate
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"sort"
+	"time"
+)
+
+/*
+Mixer runs a single animation whose output is composited from any number of
+named layers, each driven by its own XferFnAtTime.  Layers may be added and
+removed while the animation is running.
+
+Layers are composited in ascending z-order: the lowest layer receives the
+animation's baseFn as its own baseFn, and each layer above it receives the
+output of the layer beneath it.  Each layer's clock starts at zero when it's
+added.  A layer that asks to exit is removed immediately, so a layer that
+should disappear smoothly must fade itself out (see FadeOutOnExit); Remove
+performs such a fade on the layer's behalf.
+
+Mixer instances must be created by NewMixer--its zero value is not valid for
+use.  As with the EventChan returned by Animate, calling Add, Remove, or Send
+after a value has been received from Err will panic.
+*/
+type Mixer struct {
+	e  <-chan error
+	ev EventChan
+	c  CancelFunc
+}
+
+type mixerLayer struct {
+	name     string
+	z        int
+	xft      XferFnAtTime
+	start    time.Duration
+	removing bool
+	fadeFrom time.Duration
+	fade     time.Duration
+}
+
+type mixerAdd struct {
+	name string
+	z    int
+	xft  XferFnAtTime
+}
+
+type mixerRemove struct {
+	name string
+	fade time.Duration
+}
+
+type mixerEvent struct {
+	name  string
+	event interface{}
+}
+
+// NewMixer starts a Mixer animation with no layers on gamma.Client cl.  The
+// Options are passed through to Animate.
+func NewMixer(cl *gamma.Client, opts ...Option) *Mixer {
+	m := new(Mixer)
+	m.e, m.ev, m.c = Animate(cl, mixer(), opts...)
+	return m
+}
+
+// Add adds a layer with the given name and z-order.  If a layer with the same
+// name already exists, it's replaced.
+func (m *Mixer) Add(name string, z int, xft XferFnAtTime) {
+	m.ev <- mixerAdd{name, z, xft}
+}
+
+// Remove fades the named layer out over the given duration, handing control
+// back to the layers beneath it, and then removes it.  Removing a layer that
+// doesn't exist is a no-op.
+func (m *Mixer) Remove(name string, fade time.Duration) {
+	m.ev <- mixerRemove{name, fade}
+}
+
+// Send sends an event to the named layer's XferFnAtTime.  Events for layers
+// that don't exist are dropped.
+func (m *Mixer) Send(name string, event interface{}) {
+	m.ev <- mixerEvent{name, event}
+}
+
+// Err returns the (<-chan error) e returned by Animate for the Mixer's
+// animation.
+func (m *Mixer) Err() <-chan error {
+	return m.e
+}
+
+// Cancel cancels the Mixer's animation.  See CancelFunc.
+func (m *Mixer) Cancel() {
+	m.c()
+}
+
+// mixer returns the XferFnAtTime that drives a Mixer.
+func mixer() XferFnAtTime {
+	var layers []*mixerLayer
+
+	find := func(name string) int {
+		for idx, l := range layers {
+			if l.name == name {
+				return idx
+			}
+		}
+		return -1
+	}
+
+	return func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (
+		fn gamma.XferFn, sleepFor time.Duration, exit bool,
+	) {
+		var target string
+		switch e := event.(type) {
+		case mixerAdd:
+			if idx := find(e.name); idx >= 0 {
+				layers = append(layers[:idx], layers[idx+1:]...)
+			}
+			layers = append(layers, &mixerLayer{
+				name: e.name, z: e.z, xft: e.xft, start: t,
+			})
+			sort.SliceStable(layers, func(i, j int) bool {
+				return layers[i].z < layers[j].z
+			})
+			event = nil
+		case mixerRemove:
+			if idx := find(e.name); idx >= 0 && !layers[idx].removing {
+				layers[idx].removing = true
+				layers[idx].fadeFrom = t
+				layers[idx].fade = e.fade
+			}
+			event = nil
+		case mixerEvent:
+			target = e.name
+			event = e.event
+		}
+
+		fn = baseFn
+		sleepFor = time.Hour
+		for idx := 0; idx < len(layers); {
+			l := layers[idx]
+			var layerEvent interface{}
+			if l.name == target {
+				layerEvent = event
+			}
+			out, layerSleep, layerExit := l.xft(
+				t-l.start, fn, layerEvent)
+			if l.removing {
+				if l.fade <= 0 || t-l.fadeFrom >= l.fade {
+					layerExit = true
+				} else {
+					out = out.Blend(fn, float64(t-l.fadeFrom)/
+						float64(l.fade))
+					layerSleep = 0
+				}
+			}
+			if layerExit {
+				layers = append(layers[:idx], layers[idx+1:]...)
+				sleepFor = 0
+				continue
+			}
+			if layerSleep < sleepFor {
+				sleepFor = layerSleep
+			}
+			fn = out
+			idx++
+		}
+		return
+	}
+}
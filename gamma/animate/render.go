@@ -0,0 +1,51 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package animate
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"time"
+)
+
+/*
+Render evaluates an animation offline, without touching the CRTCs, and returns
+its frames as [Red, Green, Blue] ramps of rampSize entries, quantized as
+gamma.Session.SetGamma would quantize them (see gamma.EvaluateRamp).
+
+The animation clock starts at 0 and advances by interval for each frame,
+regardless of the sleepFor that xft returns, until xft asks to exit (the frame
+in which it does so is included) or the clock passes duration.  xft is passed
+baseFn as its baseFn and never receives any events.  If interval isn't
+positive, only the first frame is rendered.
+*/
+func Render(
+	xft XferFnAtTime, baseFn gamma.XferFn,
+	duration, interval time.Duration, rampSize int,
+) [][3][]uint16 {
+	var frames [][3][]uint16
+	for t := time.Duration(0); t <= duration; t += interval {
+		fn, _, exit := xft(t, baseFn, nil)
+		var frame [3][]uint16
+		for ch := range frame {
+			frame[ch] = gamma.EvaluateRamp(fn, gamma.Channel(ch), rampSize)
+		}
+		frames = append(frames, frame)
+		if exit || interval <= 0 {
+			break
+		}
+	}
+	return frames
+}
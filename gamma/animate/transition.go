@@ -0,0 +1,68 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package animate
+
+import (
+	"github.com/branen/go-xrr-gamma/gamma"
+	"time"
+)
+
+/*
+Transitioner returns an XferFnAtTime that applies defaultFn until it receives
+an event of type gamma.XferFn, and then blends smoothly (see
+gamma.XferFn.Blend) from the XferFn it was applying to the event's XferFn over
+the given duration.  As with Keyframes, the XferFns are applied to the output
+of the animation's baseFn.
+
+If an event arrives mid-transition, the new transition starts from wherever the
+interrupted one had reached, so there's never a jump.  (The XferFn reached is
+memoized (see gamma.Memoize), so that repeated interruptions don't build up an
+ever-deeper chain of blends.)  Other events are ignored, and Transitioner never
+exits on its own, so it's typically wrapped in FadeOutOnExit or cancelled.
+*/
+func Transitioner(defaultFn gamma.XferFn, duration time.Duration) XferFnAtTime {
+	var (
+		from, to gamma.XferFn = defaultFn, defaultFn
+		start    time.Duration
+	)
+	// at returns the XferFn reached at time t.
+	at := func(t time.Duration) (fn gamma.XferFn, done bool) {
+		if duration <= 0 || t-start >= duration {
+			return to, true
+		}
+		return from.Blend(to, float64(t-start)/float64(duration)), false
+	}
+	return func(
+		t time.Duration, baseFn gamma.XferFn, event interface{},
+	) (
+		fn gamma.XferFn, sleepFor time.Duration, exit bool,
+	) {
+		if target, ok := event.(gamma.XferFn); ok && target != nil {
+			if cur, done := at(t); done {
+				from = cur
+			} else {
+				from = gamma.Memoize(cur, 1024)
+			}
+			to, start = target, t
+		}
+		cur, done := at(t)
+		if done {
+			// Sleep until the next event.
+			sleepFor = time.Hour
+		}
+		return baseFn.Chain(cur), sleepFor, false
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"image/color"
+	"math"
+)
+
+/*
+ColorFn is a transfer function that, unlike XferFn, sees all three channels of
+a color at once, so it can mix them.  Like an XferFn, its inputs and outputs
+are normalized to [0, 1].
+
+The CRTC lookup tables are per-channel, so they can't represent a ColorFn in
+general.  ColorFn.XferFn (and Session.SetColorGamma, which uses it) projects a
+ColorFn onto the gray axis: each channel's ramp is the ColorFn's output for
+that channel when all three inputs are equal.  This is exact for ColorFns that
+don't mix channels, and it's exact for any ColorFn on grays; but colors off the
+gray axis are only approximated, so hue rotations, for example, can't be
+represented at all.  For true cross-channel correction on capable drivers, see
+Session.SetColorMatrix.
+*/
+type ColorFn func(r, g, b float64) (rOut, gOut, bOut float64)
+
+// XferFn projects a ColorFn onto the gray axis, as described under ColorFn.
+func (fn ColorFn) XferFn() XferFn {
+	return func(ch Channel, in float64) (out float64) {
+		var outs [_channel_cardinality_]float64
+		outs[Red], outs[Green], outs[Blue] = fn(in, in, in)
+		return outs[ch]
+	}
+}
+
+/*
+MatrixFn returns a ColorFn that applies the 3x3 linear transform m to a color,
+such that
+
+	rOut = m[0][0]*r + m[0][1]*g + m[0][2]*b
+
+and so on for gOut (m[1]) and bOut (m[2]), and clamps the results to [0, 1].
+This can apply a measured primaries or white-point correction matrix, subject
+to the limitations of the lookup tables described under ColorFn: through
+SetColorGamma, only each row's sum (its effect on grays) takes effect.
+*/
+func MatrixFn(m [3][3]float64) ColorFn {
+	return func(r, g, b float64) (rOut, gOut, bOut float64) {
+		clamp := func(c float64) float64 {
+			return math.Max(math.Min(c, 1), 0)
+		}
+		in := [3]float64{r, g, b}
+		var out [3]float64
+		for row := range m {
+			for col := range m[row] {
+				out[row] += m[row][col] * in[col]
+			}
+			out[row] = clamp(out[row])
+		}
+		return out[0], out[1], out[2]
+	}
+}
+
+// luma returns a color's Rec. 709 luma.
+func luma(r, g, b float64) float64 {
+	return 0.2126*r + 0.7152*g + 0.0722*b
+}
+
+/*
+PreserveLuminance returns a ColorFn that applies fn and then scales its output
+so that its Rec. 709 luma (0.2126*r + 0.7152*g + 0.0722*b) equals the input's.
+This keeps a tint from darkening the screen: e.g. a red tint that attenuates
+green and blue is compensated by raising all three channels.
+
+The scaled output is clamped to [0, 1], so luma can't be preserved for bright
+inputs that fn darkens a lot; those are raised as far as they can be.  Outputs
+with zero luma are left alone.
+*/
+func (fn ColorFn) PreserveLuminance() ColorFn {
+	return func(r, g, b float64) (rOut, gOut, bOut float64) {
+		rOut, gOut, bOut = fn(r, g, b)
+		yOut := luma(rOut, gOut, bOut)
+		if yOut <= 0 {
+			return
+		}
+		scale := luma(r, g, b) / yOut
+		clamp := func(c float64) float64 {
+			return math.Max(math.Min(c*scale, 1), 0)
+		}
+		return clamp(rOut), clamp(gOut), clamp(bOut)
+	}
+}
+
+// SetColorGamma programs the CRTCs gamma lookup tables using a ColorFn, by way
+// of its projection onto the gray axis (see ColorFn).  It's equivalent to
+// SetGamma(fn.XferFn()).
+func (s *Session) SetColorGamma(fn ColorFn) {
+	s.SetGamma(fn.XferFn())
+}
+
+/*
+TintFn returns an XferFn that tints the screen with the color c, by multiplying
+each channel by c's corresponding component, normalized to [0, 1].  strength,
+which is clamped to [0, 1], blends the coefficients from neutral (0) to c's
+components (1).  For example, TintFn(color.RGBA{255, 128, 0, 255}, 1) leaves
+red alone, halves green, and removes blue.  Since c's components are used as
+they are, a dark color dims the screen as well as tinting it.
+
+c's alpha is treated as an additional strength: the effective strength is
+strength * alpha, so a half-transparent color tints half as strongly, and a
+fully transparent color doesn't tint at all.
+*/
+func TintFn(c color.Color, strength float64) XferFn {
+	nc := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	strength = math.Max(math.Min(strength, 1), 0) * float64(nc.A) / 0xffff
+	var coef [_channel_cardinality_]float64
+	for ch, v := range []uint16{nc.R, nc.G, nc.B} {
+		coef[ch] = 1 - strength + strength*float64(v)/0xffff
+	}
+	return func(ch Channel, in float64) (out float64) {
+		return in * coef[ch]
+	}
+}
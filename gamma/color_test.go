@@ -0,0 +1,88 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestMatrixFn(t *testing.T) {
+	fn := MatrixFn([3][3]float64{
+		{0.9, 0.1, 0},
+		{0, 1, 0.5},
+		{0, 0, 0.5},
+	})
+	if r, g, b := fn(1, 0, 0); r != 0.9 || g != 0 || b != 0 {
+		t.Fatalf("unexpected transform of red: %g %g %g", r, g, b)
+	}
+	if _, g, _ := fn(1, 1, 1); g != 1 {
+		t.Fatalf("expected green to be clamped to 1, got %g", g)
+	}
+
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+	s.SetColorGamma(fn)
+	// On the gray axis, each channel is scaled by its row's sum.
+	if v := x.ramps[0][Blue][128]; v != quantize(0.25) {
+		t.Fatalf("expected %d, got %d", quantize(0.25), v)
+	}
+	if v := x.ramps[0][Red][128]; v != quantize(0.5) {
+		t.Fatalf("expected %d, got %d", quantize(0.5), v)
+	}
+}
+
+func TestTintFn(t *testing.T) {
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-3 }
+	fn := TintFn(color.RGBA{255, 128, 0, 255}, 1)
+	if !near(fn(Red, 1), 1) || !near(fn(Green, 1), 0.502) ||
+		fn(Blue, 1) != 0 {
+		t.Fatal("TintFn didn't scale by the color's components")
+	}
+	fn = TintFn(color.RGBA{255, 128, 0, 255}, 0.5)
+	if !near(fn(Blue, 1), 0.5) {
+		t.Fatalf("expected a half-strength tint, got %f", fn(Blue, 1))
+	}
+	// A half-transparent color, premultiplied as color.RGBA requires.
+	fn = TintFn(color.RGBA{0, 0, 0, 128}, 1)
+	if !near(fn(Red, 1), 0.498) {
+		t.Fatalf("expected alpha to scale the strength, got %f",
+			fn(Red, 1))
+	}
+	if fn = TintFn(color.Transparent, 1); fn(Green, 0.5) != 0.5 {
+		t.Fatal("a transparent color tinted the screen")
+	}
+}
+
+func TestPreserveLuminance(t *testing.T) {
+	red := MatrixFn([3][3]float64{
+		{1, 0, 0},
+		{0, 0.5, 0},
+		{0, 0, 0.5},
+	})
+	fn := red.PreserveLuminance()
+	r, g, b := fn(0.2, 0.2, 0.2)
+	if y := luma(r, g, b); math.Abs(y-0.2) > 1e-9 {
+		t.Fatalf("expected a luma of 0.2, got %f", y)
+	}
+	if r <= g || g != b {
+		t.Fatalf("the tint was lost: %g %g %g", r, g, b)
+	}
+	if r, g, b = fn(0, 0, 0); r != 0 || g != 0 || b != 0 {
+		t.Fatal("black didn't stay black")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"fmt"
+)
+
+// These errors, or errors wrapping them, are returned when the corresponding
+// Xlib or XRandR operation fails.  Use errors.Is to test for them.
+var (
+	// XOpenDisplay failed.
+	ErrNoDisplay error = fmt.Errorf("Could not open X display.")
+	// The Client has been closed, or is being closed (see Client.Hold).
+	ErrClientClosed error = fmt.Errorf("Client has been closed.")
+	// The X server doesn't support the XRandR extension.
+	ErrNoRandR error = fmt.Errorf("XRandR extension not available.")
+	// The X server's XRandR version is too old for the requested feature.
+	ErrRandRVersion error = fmt.Errorf("XRandR version too old.")
+	// XRRGetScreenResourcesCurrent failed.
+	ErrScreenResources error = fmt.Errorf("Error getting XRRScreenResources.")
+	// The X screen has no CRTCs (e.g. the X server is headless).
+	ErrNoCrtcs error = fmt.Errorf("X screen has no CRTCs.")
+	// XRRGetCrtcGammaSize failed.
+	ErrGammaSize error = fmt.Errorf("Error getting CrtcGammaSize.")
+	// XRRAllocGamma failed.
+	ErrGammaAlloc error = fmt.Errorf("Error allocating XRRCrtcGamma.")
+	// XRRGetCrtcGamma failed.
+	ErrCrtcRead error = fmt.Errorf("Error getting CrtcGamma.")
+	// XRRGetOutputInfo failed.
+	ErrOutputInfo error = fmt.Errorf("Error getting XRROutputInfo.")
+	// XRRGetCrtcInfo failed.
+	ErrCrtcInfo error = fmt.Errorf("Error getting XRRCrtcInfo.")
+	// The lookup tables didn't read back as they were written.
+	ErrVerify error = fmt.Errorf("Gamma read-back did not match.")
+	// A named output doesn't exist or isn't driven by a CRTC.
+	ErrNoOutput error = fmt.Errorf("Output is not active.")
+	// An output doesn't have the requested property (e.g. CTM).
+	ErrNoProperty error = fmt.Errorf("Output property not available.")
+	// An output property didn't read back as it was written.
+	ErrPropertyWrite error = fmt.Errorf("Output property write did not take effect.")
+	// A change made by ApplyWithTimeout wasn't confirmed and was reverted.
+	ErrNotConfirmed error = fmt.Errorf("Gamma change was not confirmed.")
+	// Restore couldn't write some CRTCs' captured values back verbatim, and
+	// resampled them instead.
+	ErrInexactRestore error = fmt.Errorf("Lookup tables were restored inexactly.")
+	// A serialized LookupTable or SnapshotStore couldn't be decoded.
+	ErrCorruptSnapshot error = fmt.Errorf("Corrupt gamma snapshot.")
+)
+
+// XError is an error reported by the X server, e.g. BadValue in response to an
+// invalid gamma ramp.  Since Xlib reports errors asynchronously, they're
+// returned by the first method that waits for the X server after the error
+// occurs (see Client.Sync), which isn't necessarily the method that caused it.
+type XError struct {
+	// The error code, e.g. 2 for BadValue.
+	Code uint8
+	// The major and minor opcodes of the failed request.  For XRandR
+	// requests, Request is the extension's major opcode and Minor
+	// identifies the request.
+	Request, Minor uint8
+	// The error's description, as given by XGetErrorText.
+	Text string
+}
+
+func (e *XError) Error() string {
+	return fmt.Sprintf("X error %d (%s) in request %d.%d.", e.Code, e.Text,
+		e.Request, e.Minor)
+}
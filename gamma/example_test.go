@@ -41,3 +41,10 @@ func ExampleXferFn() {
 	// 0.0
 	// 0.4
 }
+
+func ExampleXferFn_Blend() {
+	halfway := IdentityFn().Blend(DimFn(0), 0.5)
+	fmt.Printf("%01.1f\n", halfway(Red, 0.8))
+	// Output:
+	// 0.4
+}
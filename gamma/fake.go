@@ -0,0 +1,324 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"fmt"
+)
+
+// fakeBackend is a pure-Go xbackend that simulates a set of CRTCs whose
+// lookup tables start out linear.  Each CRTC is driven by one output, named
+// "OUT-<idx>"; CRTC and output IDs are their indices plus one.
+type fakeBackend struct {
+	noRandR bool
+	version [2]int
+	// If set, mangle is applied to each value passed to setCrtcGamma, as
+	// by a driver that doesn't apply gamma faithfully.
+	mangle func(v uint16) uint16
+	// If positive, allocGamma fails once this many buffers are allocated.
+	allocLimit int
+	// [crtc][channel][idx]
+	ramps  [][_channel_cardinality_][]uint16
+	sets   int
+	allocs int
+	closed bool
+	// sizeQueries counts calls to getCrtcGammaSize.
+	sizeQueries int
+	// stamp is the screen's configuration timestamp, which resize
+	// advances.
+	stamp uint64
+	// atoms lists the atoms that exist; each atom's ID is its index + 1.
+	atoms []string
+	// props holds the output properties that exist and their values.
+	props map[xoutput]map[xatom][]uint32
+	// ranges holds the valid ranges of range properties.
+	ranges map[xatom][2]int64
+	// If set, changeOutputProperty32 has no effect.
+	ignorePropWrites bool
+	// providers is returned by getProviders.
+	providers []xproviderInfo
+	// If positive, this many calls to getScreenResourcesCurrent fail.
+	resourceFailures int
+	// xerr is returned, once, by the next call to sync.
+	xerr error
+	// rotations holds each CRTC's rotation; CRTCs that aren't listed
+	// aren't rotated.
+	rotations map[xcrtc]int
+	// If set, getCrtcGamma fails.
+	failReads bool
+}
+
+func newFakeBackend(sizes ...int) *fakeBackend {
+	x := &fakeBackend{
+		version: [2]int{1, 5},
+		ramps:   make([][_channel_cardinality_][]uint16, len(sizes)),
+	}
+	for crtc, size := range sizes {
+		for ch := range x.ramps[crtc] {
+			x.ramps[crtc][ch] = make([]uint16, size)
+			for idx := range x.ramps[crtc][ch] {
+				x.ramps[crtc][ch][idx] = uint16(idx * 65535 / (size - 1))
+			}
+		}
+	}
+	return x
+}
+
+// resize simulates hotplugging, replacing the CRTCs with ones of the given
+// sizes.
+func (x *fakeBackend) resize(sizes ...int) {
+	allocs, sizeQueries, stamp := x.allocs, x.sizeQueries, x.stamp
+	*x = *newFakeBackend(sizes...)
+	x.allocs, x.sizeQueries, x.stamp = allocs, sizeQueries, stamp+1
+}
+
+var _ xbackend = (*fakeBackend)(nil)
+
+/*
+NewFakeClient is for tests only.  It returns a Client whose X display is
+simulated in memory, so that code built on this package can be tested without
+an X server; it never touches a real display.  The simulated screen has one
+CRTC for each of the given lookup table sizes, which must be at least 2, each
+driven by one output named "OUT-<idx>" and programmed with a linear ramp.  The
+returned FakeDisplay inspects and manipulates the simulated lookup tables.
+
+The simulated outputs have no properties (see Session.SetOutputBrightness), and
+the screen has no providers.
+*/
+func NewFakeClient(sizes ...int) (*Client, *FakeDisplay, error) {
+	for idx, size := range sizes {
+		if size < 2 {
+			return nil, nil, fmt.Errorf("CRTC %d: a lookup table "+
+				"needs at least 2 entries, got %d.", idx, size)
+		}
+	}
+	x := newFakeBackend(sizes...)
+	cl := newClient(x)
+	return cl, &FakeDisplay{x: x, cl: cl}, nil
+}
+
+// FakeDisplay is the simulated X display behind a Client returned by
+// NewFakeClient, for tests only.  Its methods are safe to call while the Client is in use,
+// e.g. by a running animation.
+type FakeDisplay struct {
+	x  *fakeBackend
+	cl *Client
+}
+
+// Ramp returns a copy of channel ch of CRTC crtcIndex's lookup table.
+func (d *FakeDisplay) Ramp(crtcIndex int, ch Channel) []uint16 {
+	d.cl.mutex.Lock()
+	defer d.cl.mutex.Unlock()
+	return append([]uint16(nil), d.x.ramps[crtcIndex][ch]...)
+}
+
+// SetRamp overwrites channel ch of CRTC crtcIndex's lookup table with ramp,
+// as another process would.  ramp must have the CRTC's size.
+func (d *FakeDisplay) SetRamp(crtcIndex int, ch Channel, ramp []uint16) {
+	d.cl.mutex.Lock()
+	defer d.cl.mutex.Unlock()
+	copy(d.x.ramps[crtcIndex][ch], ramp)
+}
+
+// Sets returns the number of times that the CRTCs' lookup tables have been
+// programmed through the Client.
+func (d *FakeDisplay) Sets() int {
+	d.cl.mutex.Lock()
+	defer d.cl.mutex.Unlock()
+	return d.x.sets
+}
+
+// FailReads, if true, causes reads of the lookup tables to fail, as they do
+// on some displays.
+func (d *FakeDisplay) FailReads(b bool) {
+	d.cl.mutex.Lock()
+	defer d.cl.mutex.Unlock()
+	d.x.failReads = b
+}
+
+type fakeResources struct {
+	x *fakeBackend
+}
+
+func (r fakeResources) crtcs() []xcrtc {
+	crtcs := make([]xcrtc, len(r.x.ramps))
+	for idx := range crtcs {
+		crtcs[idx] = xcrtc(idx + 1)
+	}
+	return crtcs
+}
+
+func (r fakeResources) outputs() []xoutput {
+	outputs := make([]xoutput, len(r.x.ramps))
+	for idx := range outputs {
+		outputs[idx] = xoutput(idx + 1)
+	}
+	return outputs
+}
+
+func (r fakeResources) configTimestamp() uint64 { return r.x.stamp }
+
+func (r fakeResources) free() {}
+
+type fakeGamma struct {
+	x     *fakeBackend
+	ramps [_channel_cardinality_][]uint16
+}
+
+func (g *fakeGamma) ramp(ch Channel) []uint16 { return g.ramps[ch] }
+func (g *fakeGamma) free()                    { g.x.allocs-- }
+
+func (x *fakeBackend) newGamma(size int) *fakeGamma {
+	g := &fakeGamma{x: x}
+	for ch := range g.ramps {
+		g.ramps[ch] = make([]uint16, size)
+	}
+	x.allocs++
+	return g
+}
+
+func (x *fakeBackend) queryExtension() bool { return !x.noRandR }
+
+func (x *fakeBackend) queryVersion() (major, minor int, ok bool) {
+	return x.version[0], x.version[1], !x.noRandR
+}
+
+func (x *fakeBackend) defaultScreen() int { return 0 }
+func (x *fakeBackend) screenCount() int   { return 1 }
+
+func (x *fakeBackend) getScreenResourcesCurrent(screen int) (xresources, error) {
+	if x.closed {
+		return nil, ErrScreenResources
+	}
+	if x.resourceFailures > 0 {
+		x.resourceFailures--
+		return nil, ErrScreenResources
+	}
+	return fakeResources{x}, nil
+}
+
+func (x *fakeBackend) getOutputInfo(
+	res xresources, output xoutput,
+) (xoutputInfo, bool) {
+	return xoutputInfo{
+		name: fmt.Sprintf("OUT-%d", output-1),
+		crtc: xcrtc(output),
+	}, true
+}
+
+func (x *fakeBackend) sync() error {
+	err := x.xerr
+	x.xerr = nil
+	return err
+}
+
+func (x *fakeBackend) getCrtcRotation(res xresources, crtc xcrtc) (int, bool) {
+	if rotation, ok := x.rotations[crtc]; ok {
+		return rotation, true
+	}
+	return xrotate0, true
+}
+
+func (x *fakeBackend) getProviders(
+	res xresources, screen int,
+) ([]xproviderInfo, bool) {
+	return x.providers, true
+}
+
+func (x *fakeBackend) getCrtcGammaSize(crtc xcrtc) int {
+	x.sizeQueries++
+	return len(x.ramps[crtc-1][Red])
+}
+
+func (x *fakeBackend) allocGamma(size int) xgamma {
+	if x.allocLimit > 0 && x.allocs >= x.allocLimit {
+		return nil
+	}
+	return x.newGamma(size)
+}
+
+func (x *fakeBackend) getCrtcGamma(crtc xcrtc) xgamma {
+	if x.failReads {
+		return nil
+	}
+	g := x.newGamma(len(x.ramps[crtc-1][Red]))
+	for ch := range g.ramps {
+		copy(g.ramps[ch], x.ramps[crtc-1][ch])
+	}
+	return g
+}
+
+func (x *fakeBackend) setCrtcGamma(crtc xcrtc, gamma xgamma) {
+	if len(gamma.ramp(Red)) != len(x.ramps[crtc-1][Red]) {
+		// The X server rejects lookup tables of the wrong size.
+		if x.xerr == nil {
+			x.xerr = &XError{Code: xBadValue, Request: 140,
+				Minor: xRRSetCrtcGamma, Text: "BadValue"}
+		}
+		return
+	}
+	for ch := range x.ramps[crtc-1] {
+		copy(x.ramps[crtc-1][ch], gamma.ramp(Channel(ch)))
+		if x.mangle != nil {
+			for idx, v := range x.ramps[crtc-1][ch] {
+				x.ramps[crtc-1][ch][idx] = x.mangle(v)
+			}
+		}
+	}
+	x.sets++
+}
+
+func (x *fakeBackend) internAtom(name string) xatom {
+	for idx, atom := range x.atoms {
+		if atom == name {
+			return xatom(idx + 1)
+		}
+	}
+	return 0
+}
+
+func (x *fakeBackend) queryOutputProperty(
+	output xoutput, prop xatom,
+) (info xpropertyInfo, ok bool) {
+	if _, ok = x.props[output][prop]; !ok {
+		return
+	}
+	if r, isRange := x.ranges[prop]; isRange {
+		info.isRange = true
+		info.values = r[:]
+	}
+	return
+}
+
+func (x *fakeBackend) getOutputProperty32(
+	output xoutput, prop xatom,
+) ([]uint32, bool) {
+	data, ok := x.props[output][prop]
+	return append([]uint32(nil), data...), ok
+}
+
+func (x *fakeBackend) changeOutputProperty32(
+	output xoutput, prop xatom, data []uint32,
+) {
+	if x.ignorePropWrites {
+		return
+	}
+	x.props[output][prop] = append([]uint32(nil), data...)
+}
+
+func (x *fakeBackend) closeDisplay() {
+	x.closed = true
+}
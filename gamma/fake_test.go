@@ -0,0 +1,59 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"testing"
+)
+
+func TestNewFakeClient(t *testing.T) {
+	if _, _, err := NewFakeClient(256, 1); err == nil {
+		t.Fatal("expected an error for a lookup table with 1 entry")
+	}
+	cl, d, err := NewFakeClient(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if ramp := d.Ramp(0, Green); len(ramp) != 2 || ramp[1] != 65535 {
+		t.Fatalf("expected a linear ramp, got %v", ramp)
+	}
+}
+
+func newFakeClient(sizes ...int) (*Client, *fakeBackend) {
+	cl, d, err := NewFakeClient(sizes...)
+	if err != nil {
+		panic(err)
+	}
+	return cl, d.x
+}
+
+// newFakeSession returns a Session on a fakeBackend with CRTCs of the given
+// sizes, and a function that closes the Session and its Client.
+func newFakeSession(t *testing.T, sizes ...int) (
+	*Session, *fakeBackend, func(),
+) {
+	cl, x := newFakeClient(sizes...)
+	s, err := cl.NewSession()
+	if err != nil {
+		cl.Close()
+		t.Fatal(err)
+	}
+	return s, x, func() {
+		s.Close()
+		cl.Close()
+	}
+}
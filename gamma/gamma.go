@@ -15,23 +15,15 @@
 
 package gamma
 
-/*
-#cgo LDFLAGS: -lX11 -lXrandr
-#include <X11/Xlib.h>
-#include <X11/extensions/Xrandr.h>
-
-Window GetDefaultRootWindow(Display *dpy) {
-	int screen = DefaultScreen(dpy);
-	return RootWindow(dpy, screen);
-}
-*/
-import "C"
 import (
+	"errors"
 	"fmt"
 	"math"
+	"math/bits"
 	"runtime"
+	"sort"
 	"sync"
-	"unsafe"
+	"time"
 )
 
 // Channel specifies a primary additive color channel.
@@ -68,6 +60,66 @@ func PowerFn(exp float64) XferFn {
 	}
 }
 
+// PowerFnClamped is like PowerFn, but it clamps exp to [minExp, maxExp] first.
+// Small exponents lift black harshly (the slope of math.Pow(in, exp) near 0 is
+// infinite for exp < 1), so this is useful when exp is driven by something
+// that might overshoot, like an animation.
+func PowerFnClamped(exp, minExp, maxExp float64) XferFn {
+	return PowerFn(math.Max(math.Min(exp, maxExp), minExp))
+}
+
+// SRGBEncodeFn returns the XferFn that applies the sRGB transfer function
+// (IEC 61966-2-1) to linear-light input, yielding sRGB-encoded output.  Unlike
+// PowerFn(1 / 2.2), which only approximates it, the sRGB transfer function has
+// a linear segment near black.
+func SRGBEncodeFn() XferFn {
+	return func(ch Channel, in float64) (out float64) {
+		if in <= 0.0031308 {
+			return in * 12.92
+		}
+		return 1.055*math.Pow(in, 1/2.4) - 0.055
+	}
+}
+
+// SRGBDecodeFn returns the XferFn that inverts the sRGB transfer function,
+// mapping sRGB-encoded input to linear light.  It is the inverse of
+// SRGBEncodeFn.
+func SRGBDecodeFn() XferFn {
+	return func(ch Channel, in float64) (out float64) {
+		if in <= 0.04045 {
+			return in / 12.92
+		}
+		return math.Pow((in+0.055)/1.055, 2.4)
+	}
+}
+
+// PosterizeFn returns an XferFn that quantizes its input to the given number
+// of evenly spaced levels, including 0 and 1.  levels is raised to 2 if it's
+// lower.
+func PosterizeFn(levels int) XferFn {
+	return PerceptualPosterizeFn(levels, 1)
+}
+
+/*
+PerceptualPosterizeFn is like PosterizeFn, but it spaces the levels evenly in a
+gamma-warped domain rather than a linear one: the input is raised to 1/exp,
+quantized, and raised back to exp.  With exp > 1, the levels are packed more
+closely toward black, where the eye is more sensitive to differences, so the
+visible steps appear more even.  exp is raised to a small positive number if
+it's not positive.
+*/
+func PerceptualPosterizeFn(levels int, exp float64) XferFn {
+	if levels < 2 {
+		levels = 2
+	}
+	steps := float64(levels - 1)
+	exp = math.Max(exp, 1e-3)
+	return func(ch Channel, in float64) (out float64) {
+		warped := math.Pow(math.Max(in, 0), 1/exp)
+		return math.Pow(math.Round(warped*steps)/steps, exp)
+	}
+}
+
 // DimFn returns the XferFn f(ch, in) = coef * in.
 func DimFn(coef float64) XferFn {
 	coef = math.Max(math.Min(coef, 1), 0)
@@ -76,6 +128,321 @@ func DimFn(coef float64) XferFn {
 	}
 }
 
+// BrightnessExponent is the exponent that PerceptualDimFn uses to relate
+// luminance to perceived brightness.
+const BrightnessExponent = 0.5
+
+// PerceptualDimFn is like DimFn, but its argument is the desired fraction of
+// the perceived brightness rather than of the luminance: PerceptualDimFn(0.5)
+// looks roughly half as bright, which takes a much lower coefficient than
+// DimFn(0.5).  It's PerceptualDimFnExp(perceivedFraction, BrightnessExponent).
+func PerceptualDimFn(perceivedFraction float64) XferFn {
+	return PerceptualDimFnExp(perceivedFraction, BrightnessExponent)
+}
+
+/*
+PerceptualDimFnExp is like PerceptualDimFn, but it takes the brightness
+exponent as an argument.  Following Stevens' power law, perceived brightness is
+modeled as luminance raised to exp, so the coefficient passed to DimFn is
+perceivedFraction raised to 1/exp.  Stevens measured exponents of about 0.33 for
+a small target in the dark and about 0.5 for an extended one, which is closer to
+a screen in a lit room.  perceivedFraction is clamped to [0, 1], and exp is
+raised to a small positive number if it's not positive.
+*/
+func PerceptualDimFnExp(perceivedFraction, exp float64) XferFn {
+	perceivedFraction = math.Max(math.Min(perceivedFraction, 1), 0)
+	exp = math.Max(exp, 1e-3)
+	return DimFn(math.Pow(perceivedFraction, 1/exp))
+}
+
+// TemperatureCoefficients returns the per-channel multipliers that
+// TemperatureFn(kelvin) applies.  They approximate the normalized RGB color of
+// a blackbody radiator at the given temperature, using Tanner Helland's fit to
+// Mitchell Charity's blackbody color table, and they're scaled so that the
+// brightest channel is exactly 1; warm temperatures attenuate green and blue
+// rather than darkening all three channels.  kelvin is clamped to
+// [1000, 40000].
+func TemperatureCoefficients(kelvin float64) (r, g, b float64) {
+	t := math.Max(math.Min(kelvin, 40000), 1000) / 100
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+	clamp := func(c float64) float64 {
+		return math.Max(math.Min(c/255, 1), 0)
+	}
+	r, g, b = clamp(r), clamp(g), clamp(b)
+	max := math.Max(r, math.Max(g, b))
+	return r / max, g / max, b / max
+}
+
+// TemperatureFn returns an XferFn that shifts the white point to the color of
+// a blackbody radiator at the given temperature, in kelvins, by scaling each
+// channel.  About 6600K is neutral; lower temperatures are warmer (redder) and
+// higher temperatures are cooler (bluer).  kelvin is clamped to [1000, 40000].
+// The brightest channel is never attenuated, so TemperatureFn doesn't dim the
+// screen any more than it must to shift the white point.
+func TemperatureFn(kelvin float64) XferFn {
+	var coef [_channel_cardinality_]float64
+	coef[Red], coef[Green], coef[Blue] = TemperatureCoefficients(kelvin)
+	return func(ch Channel, in float64) (out float64) {
+		return in * coef[ch]
+	}
+}
+
+// nightTable holds the per-channel coefficients used by NightFn at evenly
+// spaced strengths from 0 to 1.  Blue falls off about twice as fast as green;
+// the last row matches a ~3400K blackbody in blue, but retains more green
+// than one, which keeps the warm state from looking muddy.
+var nightTable = [...][_channel_cardinality_]float64{
+	{1.00, 1.00, 1.00},
+	{1.00, 0.96, 0.88},
+	{1.00, 0.91, 0.76},
+	{1.00, 0.86, 0.65},
+	{1.00, 0.81, 0.54},
+}
+
+// NightFn returns an XferFn for a "night mode" in the style of f.lux and
+// GNOME's Night Light.  strength, which is clamped to [0, 1], interpolates
+// from neutral (0) to a warm state (1) that attenuates blue strongly and green
+// mildly; see nightTable for the coefficients.
+func NightFn(strength float64) XferFn {
+	pos := math.Max(math.Min(strength, 1), 0) * float64(len(nightTable)-1)
+	row, frac := math.Modf(pos)
+	var coef [_channel_cardinality_]float64
+	for ch := range coef {
+		coef[ch] = nightTable[int(row)][ch]
+		if int(row) < len(nightTable)-1 {
+			coef[ch] = coef[ch]*(1-frac) +
+				nightTable[int(row)+1][ch]*frac
+		}
+	}
+	return func(ch Channel, in float64) (out float64) {
+		return in * coef[ch]
+	}
+}
+
+/*
+SplineFn returns an XferFn that interpolates smoothly between control points,
+each of which is an (input, output) pair, using a monotone cubic spline
+(Fritsch-Carlson).  Between any two adjacent control points, the curve is
+monotonic and doesn't overshoot, so a non-decreasing set of control points
+yields a non-decreasing ramp.  Inputs outside the control points take the
+output of the nearest control point.  The same curve is applied to every
+channel.
+
+There must be at least two control points, their inputs must be strictly
+increasing, and all of their values must be within [0, 1]; otherwise, an error
+is returned.
+*/
+func SplineFn(points [][2]float64) (XferFn, error) {
+	n := len(points)
+	if n < 2 {
+		return nil, fmt.Errorf("SplineFn needs at least two control points.")
+	}
+	for idx, p := range points {
+		if p[0] < 0 || p[0] > 1 || p[1] < 0 || p[1] > 1 {
+			return nil, fmt.Errorf(
+				"Control point %d (%g, %g) is outside [0, 1].",
+				idx, p[0], p[1])
+		}
+		if idx > 0 && p[0] <= points[idx-1][0] {
+			return nil, fmt.Errorf(
+				"Control point %d's input isn't increasing.", idx)
+		}
+	}
+	x := make([]float64, n)
+	y := make([]float64, n)
+	for idx, p := range points {
+		x[idx], y[idx] = p[0], p[1]
+	}
+	// Secant slopes, then tangents limited to keep each segment monotonic.
+	d := make([]float64, n-1)
+	for k := range d {
+		d[k] = (y[k+1] - y[k]) / (x[k+1] - x[k])
+	}
+	m := make([]float64, n)
+	m[0], m[n-1] = d[0], d[n-2]
+	for k := 1; k < n-1; k++ {
+		if d[k-1]*d[k] > 0 {
+			m[k] = (d[k-1] + d[k]) / 2
+		}
+	}
+	for k := range d {
+		if d[k] == 0 {
+			m[k], m[k+1] = 0, 0
+			continue
+		}
+		a, b := m[k]/d[k], m[k+1]/d[k]
+		if r := math.Hypot(a, b); r > 3 {
+			m[k], m[k+1] = 3*a/r*d[k], 3*b/r*d[k]
+		}
+	}
+	return func(ch Channel, in float64) (out float64) {
+		if in <= x[0] {
+			return y[0]
+		}
+		if in >= x[n-1] {
+			return y[n-1]
+		}
+		k := sort.SearchFloat64s(x, in) - 1
+		h := x[k+1] - x[k]
+		t := (in - x[k]) / h
+		t2, t3 := t*t, t*t*t
+		out = (2*t3-3*t2+1)*y[k] + (t3-2*t2+t)*h*m[k] +
+			(-2*t3+3*t2)*y[k+1] + (t3-t2)*h*m[k+1]
+		return math.Max(math.Min(out, 1), 0)
+	}, nil
+}
+
+// Memoize returns an XferFn that approximates fn by linear interpolation
+// between samples points per channel, which are evenly spaced over [0, 1]
+// (inclusive) and evaluated once, when Memoize is called.  This speeds up
+// expensive XferFns that are applied repeatedly, e.g. each frame of an
+// animation, at the cost of a little accuracy.  Inputs are clamped to [0, 1],
+// and samples is raised to 2 if it's lower.
+func Memoize(fn XferFn, samples int) XferFn {
+	if samples < 2 {
+		samples = 2
+	}
+	var table [_channel_cardinality_][]float64
+	for ch := range table {
+		table[ch] = make([]float64, samples)
+		for idx := range table[ch] {
+			table[ch][idx] = fn(Channel(ch),
+				float64(idx)/float64(samples-1))
+		}
+	}
+	return func(ch Channel, in float64) (out float64) {
+		t := table[ch]
+		in = math.Max(math.Min(in, 1), 0)
+		base, frac := math.Modf(in * float64(len(t)-1))
+		if int(base) >= len(t)-1 {
+			return t[len(t)-1]
+		}
+		return t[int(base)]*(1-frac) + t[int(base)+1]*frac
+	}
+}
+
+/*
+QuantizeToSize returns an XferFn that previews what a display shows when fn is
+programmed by SetGamma into a CRTC whose gamma ramp has the given size: fn is
+sampled and quantized exactly as SetGamma would (see EvaluateRamp), and each
+input is then mapped to a ramp entry as the hardware maps pixel values, with
+inputs of 0 and 1 selecting the first and last entries and the rest rounded to
+the nearest entry in between.  There's no interpolation between entries, so a
+curve with more detail than the ramp can hold shows up as steps.  Inputs are
+clamped to [0, 1], and size is raised to 2 if it's lower.
+*/
+func QuantizeToSize(fn XferFn, size int) XferFn {
+	if size < 2 {
+		size = 2
+	}
+	var ramps [_channel_cardinality_][]uint16
+	for ch := range ramps {
+		ramps[ch] = EvaluateRamp(fn, Channel(ch), size)
+	}
+	return func(ch Channel, in float64) (out float64) {
+		in = math.Max(math.Min(in, 1), 0)
+		idx := int(math.Round(in * float64(size-1)))
+		return float64(ramps[ch][idx]) / 65535.0
+	}
+}
+
+// ClipReport samples channel ch of fn at samples points evenly spaced over
+// [0, 1] (inclusive) and counts how many of its outputs fall below 0 or above
+// 1.  SetGamma clamps such outputs, flattening the curve, so a calibration tool
+// can use ClipReport to warn that a correction is too aggressive.  samples is
+// raised to 2 if it's lower.
+func ClipReport(fn XferFn, ch Channel, samples int) (
+	clippedLow, clippedHigh int,
+) {
+	if samples < 2 {
+		samples = 2
+	}
+	for idx := 0; idx < samples; idx++ {
+		switch out := fn(ch, float64(idx)/float64(samples-1)); {
+		case out < 0:
+			clippedLow++
+		case out > 1:
+			clippedHigh++
+		}
+	}
+	return
+}
+
+/*
+Invert returns an XferFn that approximates the inverse of channel ch of fn, for
+turning a measured response into a correction curve: fn.Chain(inv) is close to
+the identity.  fn is sampled at samples points evenly spaced over [0, 1]
+(inclusive), and the inverse interpolates linearly between them.  The same
+inverse curve is applied to every channel.
+
+fn must be monotonic (either non-decreasing or non-increasing) over [0, 1], and
+its output must not be constant; otherwise, an error is returned.  Where fn is
+flat, the inverse returns the lowest such input, and inputs outside fn's output
+range take the output of the nearest endpoint.  samples is raised to 2 if it's
+lower.
+*/
+func Invert(fn XferFn, ch Channel, samples int) (XferFn, error) {
+	if samples < 2 {
+		samples = 2
+	}
+	x := make([]float64, samples)
+	y := make([]float64, samples)
+	for idx := range x {
+		x[idx] = float64(idx) / float64(samples-1)
+		y[idx] = fn(ch, x[idx])
+	}
+	decreasing := y[samples-1] < y[0]
+	if y[samples-1] == y[0] {
+		return nil, fmt.Errorf("Cannot invert a constant XferFn.")
+	}
+	if decreasing {
+		for i, j := 0, samples-1; i < j; i, j = i+1, j-1 {
+			x[i], x[j] = x[j], x[i]
+			y[i], y[j] = y[j], y[i]
+		}
+	}
+	for idx := 1; idx < samples; idx++ {
+		if y[idx] < y[idx-1] {
+			return nil, fmt.Errorf("XferFn isn't monotonic near "+
+				"input %g.", x[idx])
+		}
+	}
+	return func(_ Channel, in float64) (out float64) {
+		if in <= y[0] {
+			return x[0]
+		}
+		if in >= y[samples-1] {
+			return x[samples-1]
+		}
+		k := sort.SearchFloat64s(y, in)
+		if y[k] == in {
+			if decreasing {
+				// The lowest input is at the end of the run.
+				for k+1 < samples && y[k+1] == in {
+					k++
+				}
+			}
+			return x[k]
+		}
+		t := (in - y[k-1]) / (y[k] - y[k-1])
+		return x[k-1]*(1-t) + x[k]*t
+	}, nil
+}
+
 // Chain combines two XferFns a and b such that a.Chain(b)(x) = b(a(x)).
 func (a XferFn) Chain(b XferFn) XferFn {
 	return func(ch Channel, in float64) (out float64) {
@@ -90,13 +457,76 @@ func (a XferFn) Mul(b XferFn) XferFn {
 	}
 }
 
-type crtcGamma struct {
-	crtc  C.RRCrtc
-	size  C.int
-	gamma *C.XRRCrtcGamma
+// Blend combines two XferFns a and b such that
+// a.Blend(b, weight)(x) = a(x) * (1 - weight) + b(x) * weight.  weight is
+// clamped to [0, 1].
+func (a XferFn) Blend(b XferFn, weight float64) XferFn {
+	weight = math.Max(math.Min(weight, 1), 0)
+	return func(ch Channel, in float64) (out float64) {
+		return a(ch, in)*(1-weight) + b(ch, in)*weight
+	}
+}
+
+/*
+When returns an XferFn that applies a if enabled returns true and passes its
+input through unchanged otherwise.  enabled is called on every evaluation, so
+an effect can be toggled (e.g. between frames of an animation) without
+rebuilding the XferFn chain.
+
+enabled is called from whichever goroutine evaluates the XferFn--for an
+animation, that's the animation's goroutine--so if it reads state that another
+goroutine changes, it must synchronize (e.g. with sync/atomic).  A change that
+lands while a ramp is being computed may take effect partway through that
+ramp; it's fully in effect by the next SetGamma.
+*/
+func (a XferFn) When(enabled func() bool) XferFn {
+	return func(ch Channel, in float64) (out float64) {
+		if enabled() {
+			return a(ch, in)
+		}
+		return in
+	}
 }
 
-type gammaVector *[65536]C.ushort
+// Masked returns an XferFn that applies a only to inputs within [lo, hi] and
+// passes other inputs through unchanged.  Outside the range, a's effect fades
+// out smoothly over a distance of feather, so that no step appears at the
+// boundaries; a feather of 0 gives hard edges.  For example,
+// PowerFn(0.8).Masked(0, 0.2, 0.1) lifts only the shadows.
+func (a XferFn) Masked(lo, hi, feather float64) XferFn {
+	return func(ch Channel, in float64) (out float64) {
+		var dist float64
+		switch {
+		case in < lo:
+			dist = lo - in
+		case in > hi:
+			dist = in - hi
+		}
+		var weight float64
+		switch {
+		case dist == 0:
+			weight = 1
+		case dist < feather:
+			// Smoothstep from 1 at the boundary to 0 at the feather's
+			// far edge.
+			x := 1 - dist/feather
+			weight = x * x * (3 - 2*x)
+		}
+		if weight == 0 {
+			return in
+		}
+		return in*(1-weight) + a(ch, in)*weight
+	}
+}
+
+type crtcGamma struct {
+	crtc  xcrtc
+	size  int
+	gamma xgamma
+	// stale is set while gamma doesn't hold the values last programmed
+	// (e.g. because it was just allocated).  See SetGammaIfChanged.
+	stale bool
+}
 
 /*
 Client represents a thread-safe, persistent connection to the XRandR extension.
@@ -106,24 +536,53 @@ Client instances must be created by NewClient--its zero value is not valid for
 use.
 */
 type Client struct {
-	dpy   *C.Display
-	root  C.Window
+	x     xbackend
 	mutex sync.Mutex
 	open  bool
+	// sizes caches, for each X screen, the lookup table size of each CRTC
+	// that a Session has loaded.  See InvalidateCrtcCache.
+	sizes map[int]crtcSizes
+	// closing is closed when Close is called, and holds counts the
+	// outstanding Holds that Close waits for.  See Hold.
+	closing chan struct{}
+	holds   sync.WaitGroup
 }
 
+// NewClient connects to the X display named by $DISPLAY.  It returns an error
+// if the display doesn't support XRandR 1.3 or newer.  (XRandR 1.2 introduced
+// the per-CRTC gamma API, and 1.3 the cheaper way of fetching the screen's
+// resources that Sessions use.)
 func NewClient() (cl *Client, err error) {
-	cl = new(Client)
-	cl.open = true
-	if cl.dpy = C.XOpenDisplay(nil); cl.dpy == nil {
-		cl = nil
-		err = fmt.Errorf("Could not open X display.")
+	var x *xlibBackend
+	if x, err = openXlibBackend(); err != nil {
+		return
+	}
+	if err = checkRandR(x); err != nil {
+		x.closeDisplay()
 		return
 	}
+	cl = newClient(x)
+	return
+}
+
+func checkRandR(x xbackend) error {
+	if !x.queryExtension() {
+		return ErrNoRandR
+	}
+	// XRandR 1.2 introduced the per-CRTC gamma API, but NewSession uses
+	// XRRGetScreenResourcesCurrent, which 1.3 introduced.
+	return requireRandR(x, 1, 3, "This package")
+}
+
+func newClient(x xbackend) (cl *Client) {
+	cl = new(Client)
+	cl.open = true
+	cl.x = x
+	cl.sizes = make(map[int]crtcSizes)
+	cl.closing = make(chan struct{})
 	runtime.SetFinalizer(cl, func(cl *Client) {
 		cl.Close()
 	})
-	cl.root = C.GetDefaultRootWindow(cl.dpy)
 	return
 }
 
@@ -131,16 +590,92 @@ func NewClient() (cl *Client, err error) {
 // has been closed, it may not be used again.
 //
 // Calling Close more than once is a no-op.
+//
+// If any long-running users of the Client, such as animations, have called
+// Hold, Close asks them to stop and waits for them to release the Client
+// before closing the X display.
 func (cl *Client) Close() {
-	if cl == nil || !cl.open {
+	if cl == nil {
+		return
+	}
+	cl.mutex.Lock()
+	if !cl.open {
+		cl.mutex.Unlock()
+		return
+	}
+	select {
+	case <-cl.closing:
+		// Another call to Close is waiting for the Holds.
+		cl.mutex.Unlock()
 		return
+	default:
 	}
+	close(cl.closing)
+	cl.mutex.Unlock()
+	cl.holds.Wait()
 	cl.mutex.Lock()
 	defer cl.mutex.Unlock()
-	C.XCloseDisplay(cl.dpy)
+	cl.x.closeDisplay()
 	cl.open = false
 }
 
+/*
+Hold registers a long-running user of the Client, such as an animation, that
+makes calls from its own goroutine.  It returns a channel, closing, that is
+closed when Close is called, and a function, release, that the user must call
+once it's done with the Client.  Close waits for every Hold to be released
+before closing the X display, so the user may go on using the Client until it
+calls release--e.g. to restore the lookup tables on its way out--but it should
+do so promptly once closing is closed.
+
+Unlike most methods, Hold doesn't panic if the Client has been closed; it
+returns an error wrapping ErrClientClosed instead, as it does while Close is
+waiting.  Calling release more than once is a no-op.  Calling Close from a
+goroutine that holds the Client deadlocks.
+*/
+func (cl *Client) Hold() (closing <-chan struct{}, release func(), err error) {
+	if cl.x == nil {
+		panic("Client instances must be created with NewClient.")
+	}
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	select {
+	case <-cl.closing:
+		return nil, nil, fmt.Errorf("Cannot hold the Client: %w",
+			ErrClientClosed)
+	default:
+	}
+	cl.holds.Add(1)
+	var once sync.Once
+	return cl.closing, func() { once.Do(cl.holds.Done) }, nil
+}
+
+/*
+InvalidateCrtcCache discards the Client's cache of CRTC lookup table sizes.
+
+To make short-lived Sessions cheap to create, a Client remembers the size of
+each CRTC's lookup table rather than querying it for every new Session.  The
+cache is tied to the configuration timestamp of the screen's resources, which
+the X server advances when the screen's configuration changes (e.g. when a
+monitor is hotplugged), so a Session created after such a change doesn't use
+stale sizes; Session.Refresh also bypasses the cache.  InvalidateCrtcCache is
+only needed for drivers that change a CRTC's lookup table size without
+advancing the timestamp.
+*/
+func (cl *Client) InvalidateCrtcCache() {
+	cl.check()
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	cl.sizes = make(map[int]crtcSizes)
+}
+
+// crtcSizes holds the lookup table sizes of an X screen's CRTCs, as of the
+// given configuration timestamp.
+type crtcSizes struct {
+	stamp uint64
+	sizes map[xcrtc]int
+}
+
 func (cl *Client) Closed() bool {
 	if cl == nil {
 		return true
@@ -150,8 +685,121 @@ func (cl *Client) Closed() bool {
 	return !cl.open
 }
 
+/*
+Sync waits for the X server to process every request that the Client has sent,
+and it returns the first X error (an *XError) reported since the last check.
+
+The methods that program the lookup tables and return an error, such as
+SetGammaRaw and Restore, check for X errors themselves.  SetGamma, which is
+meant to be cheap enough to call every frame of an animation, doesn't; call
+Sync afterward to find out whether it succeeded.
+*/
+func (cl *Client) Sync() error {
+	cl.check()
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	return cl.x.sync()
+}
+
+// RandRVersion returns the version of the XRandR extension supported by the X
+// server.  NewClient guarantees that it's at least 1.3, which suffices for
+// everything but the features documented as needing a newer version.
+func (cl *Client) RandRVersion() (major, minor int, err error) {
+	cl.check()
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	var ok bool
+	if major, minor, ok = cl.x.queryVersion(); !ok {
+		err = fmt.Errorf("Error querying XRandR version: %w", ErrNoRandR)
+	}
+	return
+}
+
+// requireRandR returns a descriptive error if the X server's XRandR version is
+// older than major.minor.  The caller must hold the Client's mutex.
+func requireRandR(x xbackend, major, minor int, feature string) error {
+	haveMajor, haveMinor, ok := x.queryVersion()
+	if !ok {
+		return fmt.Errorf("Error querying XRandR version: %w", ErrNoRandR)
+	}
+	if haveMajor < major || haveMajor == major && haveMinor < minor {
+		return fmt.Errorf("%s requires XRandR %d.%d, but only %d.%d "+
+			"is available: %w", feature, major, minor, haveMajor,
+			haveMinor, ErrRandRVersion)
+	}
+	return nil
+}
+
+// ProviderInfo describes a provider, which is XRandR's term for a GPU (or
+// another device, like a USB display adapter, that can drive outputs).
+type ProviderInfo struct {
+	Name string
+	// The number of CRTCs that the provider has.
+	Crtcs int
+	// The indices of the provider's CRTCs among the CRTCs of a Session for
+	// the default X screen, in the order used by SetGammaPerCrtc and
+	// SetGammaRaw.
+	CrtcIndices []int
+}
+
+/*
+Providers lists the providers of the display's default X screen, and which of
+the screen's CRTCs belong to each.  It requires XRandR 1.4.
+
+A Session programs all of its screen's CRTCs, whichever provider they belong
+to.  But a secondary GPU's CRTCs only belong to the screen once the GPU has
+been configured as an output source (e.g. with xrandr --setprovideroutputsource
+or by the X server's automatic configuration); until then, its monitors can't
+be gamma-corrected.  If len(CrtcIndices) < Crtcs for a provider, some of its
+CRTCs aren't part of the screen.
+*/
+func (cl *Client) Providers() ([]ProviderInfo, error) {
+	cl.check()
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	if err := requireRandR(cl.x, 1, 4, "Providers"); err != nil {
+		return nil, err
+	}
+	screen := cl.x.defaultScreen()
+	res, err := cl.x.getScreenResourcesCurrent(screen)
+	if err != nil {
+		return nil, err
+	}
+	defer res.free()
+	crtcIdx := make(map[xcrtc]int)
+	for idx, crtc := range res.crtcs() {
+		crtcIdx[crtc] = idx
+	}
+	providers, ok := cl.x.getProviders(res, screen)
+	if !ok {
+		return nil, fmt.Errorf("Error getting XRandR providers.")
+	}
+	infos := make([]ProviderInfo, len(providers), len(providers))
+	for idx, p := range providers {
+		infos[idx] = ProviderInfo{Name: p.name, Crtcs: len(p.crtcs)}
+		for _, crtc := range p.crtcs {
+			if i, ok := crtcIdx[crtc]; ok {
+				infos[idx].CrtcIndices = append(
+					infos[idx].CrtcIndices, i)
+			}
+		}
+	}
+	return infos, nil
+}
+
+// ScreenCount returns the number of X screens on the display to which the
+// Client is connected.  Most modern X servers have exactly one screen, which
+// spans every monitor; multiple screens (e.g. ":0.0" and ":0.1") are mostly
+// found in legacy multi-seat and kiosk configurations.
+func (cl *Client) ScreenCount() int {
+	cl.check()
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	return cl.x.screenCount()
+}
+
 func (cl *Client) check() {
-	if cl.dpy == nil {
+	if cl.x == nil {
 		panic("Client instances must be created with NewClient.")
 	}
 	if !cl.open {
@@ -167,82 +815,286 @@ instance, which may become stale when displays are hotplugged.  Accordingly, a
 Session should live no longer than is required to perform one or more closely
 consecutive calls to SetGamma.  If the spacing between calls is long enough to
 complete a call to NewSession (i.e. hundreds of milliseconds), then separate
-sessions should be used.
+sessions should be used, or the Session should be refreshed with Refresh.
 
 Session instances must be created by NewSession--its zero value is not valid
 for use.
 */
 type Session struct {
-	cl    *Client
-	res   *C.XRRScreenResources
-	crtcs []crtcGamma
-	open  bool
+	cl     *Client
+	screen int
+	res    xresources
+	crtcs  []crtcGamma
+	open   bool
 }
 
+// NewSession creates a Session for the display's default X screen.  It
+// returns ErrNoCrtcs if the screen has no CRTCs, as on a headless X server.
 func (cl *Client) NewSession() (s *Session, err error) {
 	cl.check()
 	cl.mutex.Lock()
 	defer cl.mutex.Unlock()
+	return cl.newSession(cl.x.defaultScreen())
+}
 
-	s = new(Session)
-	runtime.SetFinalizer(s, func(s *Session) {
-		s.Close()
-	})
-	s.cl = cl
-	s.open = true
-
-	s.res = C.XRRGetScreenResourcesCurrent(s.cl.dpy, s.cl.root)
-	if s.res == nil {
-		err = fmt.Errorf("Error getting XRRScreenResources.")
+// NewScreenSession creates a Session for the X screen with the given index,
+// which must be less than ScreenCount.
+func (cl *Client) NewScreenSession(screen int) (s *Session, err error) {
+	cl.check()
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	if screen < 0 || screen >= cl.x.screenCount() {
+		err = fmt.Errorf("Screen %d does not exist.", screen)
 		return
 	}
-	s.crtcs = make([]crtcGamma, s.res.ncrtc, s.res.ncrtc)
-	for idx := int(0); C.int(idx) < s.res.ncrtc; idx++ {
-		var crtc C.RRCrtc = (*[2 << 32]C.RRCrtc)(unsafe.Pointer(s.res.crtcs))[idx]
-		var size C.int = C.XRRGetCrtcGammaSize(s.cl.dpy, crtc)
-		if size == 0 {
-			err = fmt.Errorf("Error getting CrtcGammaSize.")
-			return
-		}
-		if ptr := C.XRRAllocGamma(size); ptr != nil {
-			s.crtcs[idx] = crtcGamma{
-				crtc:  crtc,
-				size:  size,
-				gamma: ptr,
-			}
-		} else {
-			err = fmt.Errorf("Error allocating XRRCrtcGamma.")
+	return cl.newSession(screen)
+}
+
+/*
+NewSessionRetry is like NewSession, but if NewSession fails, it waits for
+backoff and tries again, up to attempts tries in all.  If every try fails, it
+returns the last error.  This helps long-running programs ride out transient
+failures, e.g. while a mode change or hotplug is underway.  attempts is raised
+to 1 if it's lower.
+*/
+func (cl *Client) NewSessionRetry(attempts int, backoff time.Duration) (
+	s *Session, err error,
+) {
+	for try := 0; ; try++ {
+		if s, err = cl.NewSession(); err == nil || try+1 >= attempts {
 			return
 		}
+		time.Sleep(backoff)
 	}
-	return
 }
 
-// Close "closes" a Session, releasing its underlying resources.  Once a Session
-// has been closed, it may not be used again.
-//
-// Calling Close more than once is a no-op.
-func (s *Session) Close() {
-	if s == nil || !s.open {
-		return
-	}
-	s.cl.check()
-	s.cl.mutex.Lock()
-	defer s.cl.mutex.Unlock()
-	if s.res != nil {
-		C.XRRFreeScreenResources(s.res)
-	}
-	if s.crtcs != nil {
-		for _, crtc := range s.crtcs {
-			if crtc.gamma != nil {
-				C.XRRFreeGamma(crtc.gamma)
-			}
+/*
+RestoreDefault applies the default linear ramp (i.e. PowerFn(1)) to every CRTC
+on every X screen, using transient Sessions, and waits for the X server to
+apply it.  It's meant as a one-call reset for scripts and recovery paths that
+don't otherwise need a Session.  Any X error is returned.
+*/
+func (cl *Client) RestoreDefault() error {
+	for screen := 0; screen < cl.ScreenCount(); screen++ {
+		s, err := cl.NewScreenSession(screen)
+		if errors.Is(err, ErrNoCrtcs) {
+			// There's nothing to reset.
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Screen %d: %w", screen, err)
+		}
+		// Wait for the X server, so that the new ramps are in
+		// effect even if the caller exits right away.
+		err = s.SetGammaSync(PowerFn(1))
+		s.Close()
+		if err != nil {
+			return fmt.Errorf("Screen %d: %w", screen, err)
 		}
 	}
-	s.open = false
+	return nil
 }
 
-func (s *Session) Closed() bool {
+/*
+SupportsGamma probes whether the display actually applies gamma lookup tables.
+Some virtual and remote X servers (e.g. Xvfb and Xvnc) advertise XRandR but
+don't have usable lookup tables, or accept writes without honoring them.
+
+SupportsGamma writes a test ramp to the primary CRTC of the default X screen,
+checks that it reads back, and then restores the CRTC's original ramp; the other
+CRTCs aren't touched.  It returns false (and a nil error) if the screen has no
+CRTCs with lookup tables or if the test ramp doesn't read back.  Note that a
+server that reads back ramps faithfully without displaying them can't be
+detected.
+*/
+func (cl *Client) SupportsGamma() (bool, error) {
+	s, err := cl.NewSession()
+	if errors.Is(err, ErrGammaSize) || errors.Is(err, ErrNoCrtcs) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer s.Close()
+	orig, err := s.GetCrtcGamma(0)
+	if err != nil {
+		return false, err
+	}
+	// The test ramp must differ from the original, or we can't tell
+	// whether it took.
+	var origLt LookupTable
+	for ch := range origLt.t {
+		origLt.t[ch] = [][]uint16{orig[ch]}
+	}
+	probe := PowerFn(2)
+	if origLt.MaxDeviation(probe) < 0.1 {
+		probe = PowerFn(0.5)
+	}
+	return s.probePrimary(probe, orig, 256)
+}
+
+// probePrimary programs the primary CRTC with probe, reports whether it reads
+// back to within tolerance, and then programs the CRTC with orig.
+func (s *Session) probePrimary(
+	probe XferFn, orig [3][]uint16, tolerance uint16,
+) (bool, error) {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	cg := s.crtcs[0]
+	if len(orig[Red]) != cg.size {
+		return false, fmt.Errorf("CRTC 0's lookup table size changed "+
+			"from %d to %d.", cg.size, len(orig[Red]))
+	}
+	cg.fill(probe)
+	s.cl.x.setCrtcGamma(cg.crtc, cg.gamma)
+	err := s.cl.x.sync()
+	var ok bool
+	if got := s.cl.x.getCrtcGamma(cg.crtc); got != nil {
+		ok = true
+		for ch := Red; ch < _channel_cardinality_; ch++ {
+			want := EvaluateRamp(probe, ch, cg.size)
+			for idx, v := range got.ramp(ch) {
+				diff := int(v) - int(want[idx])
+				if diff > int(tolerance) || -diff > int(tolerance) {
+					ok = false
+				}
+			}
+		}
+		got.free()
+	}
+	for ch := Red; ch < _channel_cardinality_; ch++ {
+		copy(cg.gamma.ramp(ch), orig[ch])
+	}
+	s.cl.x.setCrtcGamma(cg.crtc, cg.gamma)
+	if restoreErr := s.cl.x.sync(); err == nil {
+		err = restoreErr
+	}
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (cl *Client) newSession(screen int) (s *Session, err error) {
+	s = new(Session)
+	runtime.SetFinalizer(s, func(s *Session) {
+		// The Session's resources went with the X display if its
+		// Client was closed first, and Close would panic.
+		s.cl.mutex.Lock()
+		defer s.cl.mutex.Unlock()
+		if s.cl.open && s.open {
+			s.free()
+		}
+	})
+	s.cl = cl
+	s.screen = screen
+	s.open = true
+	if err = s.load(); err != nil {
+		s = nil
+	}
+	return
+}
+
+// load fetches the Session's screen resources and allocates its gamma buffers.
+// If it fails, it frees whatever it allocated and closes the Session, rather
+// than leaving partial allocations for the finalizer.  The caller must hold the
+// Client's mutex.
+func (s *Session) load() (err error) {
+	defer func() {
+		if err != nil {
+			s.free()
+		}
+	}()
+	if s.res, err = s.cl.x.getScreenResourcesCurrent(s.screen); err != nil {
+		return
+	}
+	crtcs := s.res.crtcs()
+	if len(crtcs) == 0 {
+		err = ErrNoCrtcs
+		return
+	}
+	cache := s.cl.sizes[s.screen]
+	if stamp := s.res.configTimestamp(); cache.sizes == nil ||
+		cache.stamp != stamp {
+		cache = crtcSizes{stamp, make(map[xcrtc]int)}
+		s.cl.sizes[s.screen] = cache
+	}
+	s.crtcs = make([]crtcGamma, len(crtcs), len(crtcs))
+	for idx, crtc := range crtcs {
+		size, ok := cache.sizes[crtc]
+		if !ok {
+			size = s.cl.x.getCrtcGammaSize(crtc)
+			cache.sizes[crtc] = size
+		}
+		if size == 0 {
+			err = fmt.Errorf("CRTC %d: %w", idx, ErrGammaSize)
+			return
+		}
+		if gamma := s.cl.x.allocGamma(size); gamma != nil {
+			s.crtcs[idx] = crtcGamma{
+				crtc:  crtc,
+				size:  size,
+				gamma: gamma,
+				stale: true,
+			}
+		} else {
+			err = fmt.Errorf("CRTC %d: %w", idx, ErrGammaAlloc)
+			return
+		}
+	}
+	return
+}
+
+/*
+Refresh re-fetches the Session's screen resources and reallocates its gamma
+buffers in place, as though the Session had been closed and recreated.  This
+allows a long-lived Session to recover from displays being hotplugged,
+including changes to the CRTCs' lookup table sizes.
+
+CRTC indices (see PerCrtcFn) may change across a call to Refresh.  If Refresh
+fails, the Session is closed.
+*/
+func (s *Session) Refresh() error {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	s.check()
+	delete(s.cl.sizes, s.screen)
+	s.free()
+	s.open = true
+	return s.load()
+}
+
+// Close "closes" a Session, releasing its underlying resources.  Once a Session
+// has been closed, it may not be used again.
+//
+// Calling Close more than once is a no-op.
+func (s *Session) Close() {
+	if s == nil || !s.open {
+		return
+	}
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	s.free()
+}
+
+// free releases the Session's underlying resources and marks it closed.  The
+// caller must hold the Client's mutex.
+func (s *Session) free() {
+	if s.res != nil {
+		s.res.free()
+		s.res = nil
+	}
+	for _, crtc := range s.crtcs {
+		if crtc.gamma != nil {
+			crtc.gamma.free()
+		}
+	}
+	s.crtcs = nil
+	s.open = false
+}
+
+func (s *Session) Closed() bool {
 	if s == nil {
 		return true
 	}
@@ -261,28 +1113,633 @@ func (s *Session) check() {
 	}
 }
 
-func forGammaChannels(
-	gamma *C.XRRCrtcGamma, fn func(ch Channel, gv gammaVector),
-) {
-	fn(Red, (gammaVector)(unsafe.Pointer(gamma.red)))
-	fn(Green, (gammaVector)(unsafe.Pointer(gamma.green)))
-	fn(Blue, (gammaVector)(unsafe.Pointer(gamma.blue)))
+// quantize clamps an XferFn's output to [0, 1] and rounds it to the nearest
+// lookup table value.
+func quantize(out float64) uint16 {
+	return uint16(math.Round(math.Max(math.Min(out, 1), 0) * 65535.0))
+}
+
+// EvaluateRamp samples one channel of fn at size evenly spaced inputs and
+// returns the resulting lookup table values, quantized exactly as SetGamma
+// would quantize them for a CRTC with a gamma ramp of the given size.  It
+// doesn't need an X server, so it's suitable for testing and benchmarking
+// XferFns.
+func EvaluateRamp(fn XferFn, ch Channel, size int) []uint16 {
+	ramp := make([]uint16, size)
+	evaluateRamp(ramp, fn, ch)
+	return ramp
+}
+
+// evaluateRamp is EvaluateRamp, but it stores its result in ramp.
+func evaluateRamp(ramp []uint16, fn XferFn, ch Channel) {
+	for idx := range ramp {
+		base := float64(idx) / float64(len(ramp))
+		ramp[idx] = quantize(fn(ch, base))
+	}
+}
+
+// fill evaluates fn across the CRTC's ramp and stores the result in its gamma
+// buffer.  It doesn't send anything to the X server.
+func (cg crtcGamma) fill(fn XferFn) {
+	for ch := Red; ch < _channel_cardinality_; ch++ {
+		evaluateRamp(cg.gamma.ramp(ch), fn, ch)
+	}
 }
 
-// SetGamma programs the CRTCs gamma lookup tables using an XferFn.
+// SetGamma programs the CRTCs gamma lookup tables using an XferFn.  The
+// XferFn's output is clamped to [0, 1] and rounded to the nearest value that
+// the lookup tables can represent.
+//
+// SetGamma doesn't query the CRTCs' lookup table sizes, which would cost a
+// round trip to the X server per CRTC on every call.  If a size changes while
+// the Session is open (e.g. because a monitor was swapped), the X server
+// rejects the wrongly sized lookup table with a BadValue error, and the Session
+// adopts the new size when SetGammaSync sees that error, when it next reads
+// that CRTC's lookup table (as GetLookupTable, GetLookupTableAll, and
+// ForeignUpdateSince do), or when Refresh is called.
+//
+// For throughput, SetGamma doesn't wait for the X server: the new lookup tables
+// may still be buffered in Xlib, and not yet in effect, when it returns.  Use
+// SetGammaSync when the change must be visible before proceeding.
 func (s *Session) SetGamma(fn XferFn) {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	for idx := range s.crtcs {
+		cg := &s.crtcs[idx]
+		cg.fill(fn)
+		s.cl.x.setCrtcGamma(cg.crtc, cg.gamma)
+		cg.stale = false
+	}
+}
+
+// SetGammaSync is like SetGamma, but it then waits for the X server to process
+// the new lookup tables (see Client.Sync), so that they're in effect when it
+// returns, e.g. before taking a screenshot or timing a benchmark.  The wait
+// costs a round trip to the X server.  Any X error is returned.
+//
+// If the X server rejects a lookup table with BadValue, SetGammaSync re-checks
+// the CRTCs' lookup table sizes, and if one has changed, it adopts the new size
+// and tries once more.
+func (s *Session) SetGammaSync(fn XferFn) error {
+	s.SetGamma(fn)
+	err := s.cl.Sync()
+	if xerr, ok := err.(*XError); ok && xerr.Code == xBadValue &&
+		xerr.Minor == xRRSetCrtcGamma && s.recheckSizes() {
+		s.SetGamma(fn)
+		err = s.cl.Sync()
+	}
+	return err
+}
+
+// recheckSizes queries the CRTCs' lookup table sizes and adopts any that have
+// changed (see adoptSize).  It reports whether any had.
+func (s *Session) recheckSizes() (changed bool) {
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	for idx := range s.crtcs {
+		size := s.cl.x.getCrtcGammaSize(s.crtcs[idx].crtc)
+		if size != s.crtcs[idx].size {
+			s.adoptSize(idx, size)
+			changed = true
+		}
+	}
+	return
+}
+
+/*
+SetGammaIfChanged is like SetGamma, but it only programs the CRTCs whose lookup
+tables would change by more than tolerance in some entry, compared with the
+values that this Session last programmed.  It reports whether any CRTC was
+programmed.  This saves X traffic when fn is unchanged from the last call, as
+in the static stretches of an animation.
+
+Changes made by other processes aren't taken into account, since the Session's
+record of what it last programmed isn't refreshed from the X server; use
+SetGamma to overwrite them unconditionally.
+*/
+func (s *Session) SetGammaIfChanged(fn XferFn, tolerance uint16) bool {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	var programmed bool
+	for idx := range s.crtcs {
+		cg := &s.crtcs[idx]
+		changed := cg.stale
+		var ramps [_channel_cardinality_][]uint16
+		for ch := range ramps {
+			ramps[ch] = EvaluateRamp(fn, Channel(ch), cg.size)
+			if changed {
+				continue
+			}
+			for i, v := range cg.gamma.ramp(Channel(ch)) {
+				diff := int(ramps[ch][i]) - int(v)
+				if diff > int(tolerance) || -diff > int(tolerance) {
+					changed = true
+					break
+				}
+			}
+		}
+		if !changed {
+			continue
+		}
+		for ch := range ramps {
+			copy(cg.gamma.ramp(Channel(ch)), ramps[ch])
+		}
+		s.cl.x.setCrtcGamma(cg.crtc, cg.gamma)
+		cg.stale = false
+		programmed = true
+	}
+	return programmed
+}
+
+// adoptSize replaces the buffer of the CRTC with the given index with one of
+// the given size, which was observed when reading its lookup table.  If the
+// buffer can't be allocated, the old one is kept; Refresh reports such errors.
+// The caller must hold the Client's mutex.
+func (s *Session) adoptSize(idx, size int) {
+	cg := &s.crtcs[idx]
+	if size == cg.size || size == 0 {
+		return
+	}
+	if cache := s.cl.sizes[s.screen].sizes; cache != nil {
+		cache[cg.crtc] = size
+	}
+	gamma := s.cl.x.allocGamma(size)
+	if gamma == nil {
+		return
+	}
+	cg.gamma.free()
+	cg.size, cg.gamma, cg.stale = size, gamma, true
+}
+
+// ditherPattern is a one-dimensional Bayer matrix.  Its entries are offset by
+// one half and divided by its length to yield the dither thresholds.
+var ditherPattern = [...]float64{0, 2, 1, 3}
+
+// fillDithered is like fill, but it quantizes fn's output to the given bit
+// depth using ordered dithering across adjacent ramp entries.
+func (cg crtcGamma) fillDithered(fn XferFn, bits int) {
+	levels := float64(int(1)<<uint(bits) - 1)
+	for ch := Red; ch < _channel_cardinality_; ch++ {
+		ramp := cg.gamma.ramp(ch)
+		for idx := range ramp {
+			base := float64(idx) / float64(cg.size)
+			threshold := (ditherPattern[idx%len(ditherPattern)] + 0.5) /
+				float64(len(ditherPattern))
+			out := math.Floor(fn(ch, base)*levels+threshold) / levels
+			ramp[idx] = quantize(out)
+		}
+	}
+}
+
+/*
+SetGammaDithered is like SetGamma, but it reduces the visible banding that steep
+transfer functions produce on panels with a low bit depth.  It quantizes fn's
+output to the panel's bit depth, bits, using ordered dithering across adjacent
+ramp entries, so that the quantization error is distributed along the ramp
+rather than accumulating into visible steps.
+
+Since it changes the exact values written to the lookup tables, dithering is
+never applied by SetGamma.  Typical values for bits are 6 and 8; bits must be in
+the range [1, 16].
+*/
+func (s *Session) SetGammaDithered(fn XferFn, bits int) error {
+	if bits < 1 || bits > 16 {
+		return fmt.Errorf("Dither depth must be between 1 and 16 bits.")
+	}
 	s.cl.check()
 	s.cl.mutex.Lock()
 	defer s.cl.mutex.Unlock()
 	for _, crtcGamma := range s.crtcs {
-		forGammaChannels(crtcGamma.gamma, func(ch Channel, gv gammaVector) {
-			for idx := C.int(0); idx < crtcGamma.size; idx++ {
-				base := float64(idx) / float64(crtcGamma.size)
-				gv[idx] = C.ushort(fn(ch, base) * 65535.0)
+		crtcGamma.fillDithered(fn, bits)
+		s.cl.x.setCrtcGamma(crtcGamma.crtc, crtcGamma.gamma)
+	}
+	return s.cl.x.sync()
+}
+
+// outputCrtcs maps the names of the Session's active outputs to the indices
+// of the CRTCs that drive them.  Outputs that aren't driven by a CRTC (e.g.
+// because they're disconnected or disabled) are omitted.  The caller must hold
+// the Client's mutex.
+func (s *Session) outputCrtcs() (map[string]int, error) {
+	crtcIdx := make(map[xcrtc]int, len(s.crtcs))
+	for idx, crtcGamma := range s.crtcs {
+		crtcIdx[crtcGamma.crtc] = idx
+	}
+	outputs := make(map[string]int)
+	for _, output := range s.res.outputs() {
+		info, ok := s.cl.x.getOutputInfo(s.res, output)
+		if !ok {
+			return nil, ErrOutputInfo
+		}
+		if idx, ok := crtcIdx[info.crtc]; ok {
+			outputs[info.name] = idx
+		}
+	}
+	return outputs, nil
+}
+
+// findOutput returns the Session's output with the given name, whether or not
+// it's active.  The caller must hold the Client's mutex.
+func (s *Session) findOutput(name string) (xoutput, error) {
+	for _, output := range s.res.outputs() {
+		info, ok := s.cl.x.getOutputInfo(s.res, output)
+		if !ok {
+			return 0, ErrOutputInfo
+		}
+		if info.name == name {
+			return output, nil
+		}
+	}
+	return 0, fmt.Errorf("%q: %w", name, ErrNoOutput)
+}
+
+/*
+OutputTransform reports the current rotation and reflection of the named
+output, in the terms of xrandr's --rotate and --reflect options: "normal",
+"left", "inverted", or "right", followed by " reflect-x", " reflect-y", or
+" reflect-xy" if the output is reflected.  It returns an error wrapping
+ErrNoOutput if the output doesn't exist or isn't active.
+
+This is informational.  The gamma lookup tables map values, not positions, so
+they're unaffected by rotation and reflection; a rotated output shows the same
+gamma as it would unrotated.
+*/
+func (s *Session) OutputTransform(name string) (string, error) {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	output, err := s.findOutput(name)
+	if err != nil {
+		return "", err
+	}
+	info, ok := s.cl.x.getOutputInfo(s.res, output)
+	if !ok {
+		return "", ErrOutputInfo
+	}
+	if info.crtc == 0 {
+		return "", fmt.Errorf("%q: %w", name, ErrNoOutput)
+	}
+	rotation, ok := s.cl.x.getCrtcRotation(s.res, info.crtc)
+	if !ok {
+		return "", fmt.Errorf("%q: %w", name, ErrCrtcInfo)
+	}
+	var transform string
+	switch {
+	case rotation&xrotate90 != 0:
+		transform = "left"
+	case rotation&xrotate180 != 0:
+		transform = "inverted"
+	case rotation&xrotate270 != 0:
+		transform = "right"
+	default:
+		transform = "normal"
+	}
+	switch rotation & (xreflectX | xreflectY) {
+	case xreflectX:
+		transform += " reflect-x"
+	case xreflectY:
+		transform += " reflect-y"
+	case xreflectX | xreflectY:
+		transform += " reflect-xy"
+	}
+	return transform, nil
+}
+
+// encodeCTM encodes a color transform matrix as the CTM output property
+// expects: each coefficient is a sign-magnitude S31.32 fixed-point number,
+// split into 32-bit words with the least significant word first.
+func encodeCTM(m [9]float64) []uint32 {
+	data := make([]uint32, 0, 2*len(m))
+	for _, v := range m {
+		fixed := uint64(math.Round(math.Abs(v)*(1<<32))) &^ (1 << 63)
+		if v < 0 {
+			fixed |= 1 << 63
+		}
+		data = append(data, uint32(fixed), uint32(fixed>>32))
+	}
+	return data
+}
+
+/*
+SetColorMatrix sets an output's color transform matrix (the "CTM" output
+property), which some drivers (e.g. amdgpu and i915) apply in hardware in
+addition to the gamma lookup tables.  Unlike an XferFn, a color transform
+matrix can mix channels, which allows for true cross-channel color correction.
+
+m is in row-major order, so each output channel is computed as
+
+	out[row] = m[3*row+0]*red + m[3*row+1]*green + m[3*row+2]*blue
+
+and the identity matrix leaves colors unchanged.  An error wrapping
+ErrNoProperty is returned if the output doesn't have a CTM property.
+*/
+func (s *Session) SetColorMatrix(output string, m [9]float64) error {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	s.check()
+	out, prop, _, err := s.outputProperty(output, "CTM")
+	if err != nil {
+		return err
+	}
+	s.cl.x.changeOutputProperty32(out, prop, encodeCTM(m))
+	return s.cl.x.sync()
+}
+
+/*
+SetOutputBrightness sets an output's "Brightness" property, which some drivers
+expose to scale the output's colors in the driver.  Unlike SetGamma, which the
+property is independent of, the driver preserves it across gamma writes; unlike
+a hardware backlight, it doesn't save power.  level is clamped to [0, 1] and
+mapped onto the property's range.
+
+An error wrapping ErrNoProperty is returned if the output doesn't have a
+suitable Brightness property, and an error wrapping ErrPropertyWrite is
+returned if the new value doesn't read back.
+*/
+func (s *Session) SetOutputBrightness(output string, level float64) error {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	s.check()
+	out, prop, info, err := s.outputProperty(output, "Brightness")
+	if err != nil {
+		return err
+	}
+	if !info.isRange || len(info.values) != 2 {
+		return fmt.Errorf("%q: Brightness doesn't have a range: %w",
+			output, ErrNoProperty)
+	}
+	level = math.Max(math.Min(level, 1), 0)
+	min, max := float64(info.values[0]), float64(info.values[1])
+	want := uint32(int32(math.Round(min + level*(max-min))))
+	s.cl.x.changeOutputProperty32(out, prop, []uint32{want})
+	if err = s.cl.x.sync(); err != nil {
+		return fmt.Errorf("%q: Brightness: %w", output, err)
+	}
+	if got, ok := s.cl.x.getOutputProperty32(out, prop); !ok ||
+		len(got) != 1 || got[0] != want {
+		return fmt.Errorf("%q: Brightness: %w", output, ErrPropertyWrite)
+	}
+	return nil
+}
+
+// outputProperty looks up the named property of the named output.  If either
+// doesn't exist, it returns an error wrapping ErrNoOutput or ErrNoProperty.
+// The caller must hold the Client's mutex.
+func (s *Session) outputProperty(output, name string) (
+	out xoutput, prop xatom, info xpropertyInfo, err error,
+) {
+	if err = requireRandR(s.cl.x, 1, 2, "Output properties"); err != nil {
+		return
+	}
+	if out, err = s.findOutput(output); err != nil {
+		return
+	}
+	var ok bool
+	if prop = s.cl.x.internAtom(name); prop != 0 {
+		info, ok = s.cl.x.queryOutputProperty(out, prop)
+	}
+	if !ok {
+		err = fmt.Errorf("%q: %s: %w", output, name, ErrNoProperty)
+	}
+	return
+}
+
+/*
+SetGammaMulti programs the lookup tables of several outputs at once, each with
+its own XferFn.  fns is keyed by output name (e.g. "DP-1", as reported by
+xrandr).  CRTCs driving outputs that aren't in fns are left untouched.
+
+All of the ramps are computed before any of them are sent to the X server, and
+then they're sent back-to-back, which minimizes the visible gap between the
+outputs' updates.  If any output isn't active, or if two outputs named in fns
+are driven by the same CRTC (i.e. they're clones), nothing is programmed and an
+error is returned.
+*/
+func (s *Session) SetGammaMulti(fns map[string]XferFn) error {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	outputs, err := s.outputCrtcs()
+	if err != nil {
+		return err
+	}
+	targets := make(map[int]string, len(fns))
+	for name := range fns {
+		idx, ok := outputs[name]
+		if !ok {
+			return fmt.Errorf("%q: %w", name, ErrNoOutput)
+		}
+		if other, ok := targets[idx]; ok {
+			return fmt.Errorf(
+				"Outputs %q and %q are driven by the same CRTC.",
+				other, name)
+		}
+		targets[idx] = name
+	}
+	for idx, name := range targets {
+		s.crtcs[idx].fill(fns[name])
+	}
+	for idx := range targets {
+		s.cl.x.setCrtcGamma(s.crtcs[idx].crtc, s.crtcs[idx].gamma)
+	}
+	return s.cl.x.sync()
+}
+
+/*
+SetGammaExcept programs the lookup tables of every CRTC except those driving
+the named outputs (e.g. "HDMI-1", as reported by xrandr), which are left
+untouched.  If an excluded output is a clone, its CRTC is excluded too, along
+with the other outputs it drives.  Names of outputs that aren't active are
+ignored, so the exclusion list may name outputs that are sometimes unplugged.
+*/
+func (s *Session) SetGammaExcept(excludeOutputs []string, fn XferFn) error {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	outputs, err := s.outputCrtcs()
+	if err != nil {
+		return err
+	}
+	excluded := make(map[int]bool, len(excludeOutputs))
+	for _, name := range excludeOutputs {
+		if idx, ok := outputs[name]; ok {
+			excluded[idx] = true
+		}
+	}
+	for idx, crtcGamma := range s.crtcs {
+		if !excluded[idx] {
+			crtcGamma.fill(fn)
+			s.cl.x.setCrtcGamma(crtcGamma.crtc, crtcGamma.gamma)
+		}
+	}
+	return s.cl.x.sync()
+}
+
+/*
+SetGammaRaw programs the CRTCs gamma lookup tables with caller-provided values,
+bypassing XferFn evaluation entirely.  ramps must hold one [Red, Green, Blue]
+triple of ramps per CRTC, in CRTC index order, and each ramp's length must match
+its CRTC's lookup table size.  If they don't, nothing is programmed and an error
+is returned.
+*/
+func (s *Session) SetGammaRaw(ramps [][3][]uint16) error {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	if len(ramps) != len(s.crtcs) {
+		return fmt.Errorf("Got ramps for %d CRTCs, but there are %d.",
+			len(ramps), len(s.crtcs))
+	}
+	for crtcIdx, crtcGamma := range s.crtcs {
+		for ch := range ramps[crtcIdx] {
+			if len(ramps[crtcIdx][ch]) != crtcGamma.size {
+				return fmt.Errorf("CRTC %d has a ramp size of %d, "+
+					"but channel %d's ramp has %d values.", crtcIdx,
+					crtcGamma.size, ch, len(ramps[crtcIdx][ch]))
+			}
+		}
+	}
+	for crtcIdx, crtcGamma := range s.crtcs {
+		for ch := Red; ch < _channel_cardinality_; ch++ {
+			copy(crtcGamma.gamma.ramp(ch), ramps[crtcIdx][ch])
+		}
+		s.cl.x.setCrtcGamma(crtcGamma.crtc, crtcGamma.gamma)
+	}
+	return s.cl.x.sync()
+}
+
+/*
+SetGammaVerified is like SetGamma, but it reads the lookup tables back afterward
+and returns an error wrapping ErrVerify if any value differs from the value that
+was written by more than tolerance.  This catches drivers that silently clamp
+or ignore gamma writes.
+
+Since the non-primary CRTCs don't always read back correctly (see
+GetLookupTable), only the primary CRTC is verified.
+*/
+func (s *Session) SetGammaVerified(fn XferFn, tolerance uint16) error {
+	s.SetGamma(fn)
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		return err
+	}
+	for ch := range lt.t {
+		for crtc, lut := range lt.t[ch] {
+			for idx, got := range lut {
+				want := quantize(fn(Channel(ch),
+					float64(idx)/float64(len(lut))))
+				diff := int(got) - int(want)
+				if diff > int(tolerance) || -diff > int(tolerance) {
+					return fmt.Errorf("CRTC %d, channel %d, "+
+						"index %d: wrote %d, read %d: %w",
+						crtc, ch, idx, want, got, ErrVerify)
+				}
 			}
+		}
+	}
+	return nil
+}
+
+/*
+ApplyWithTimeout programs the CRTCs gamma lookup tables using fn, then waits
+for a value to be received from confirm (or for confirm to be closed).  If
+timeout elapses first, it reprograms them using revertTo and returns
+ErrNotConfirmed.  If an X error is reported after fn is applied, it reprograms
+them using revertTo immediately and returns the error; since X errors are
+reported asynchronously, the error may have been caused by an earlier call, but
+fn can't be left in place without the safety net.
+
+This is a safety net for interactive tools that may apply a change that leaves
+the screen unreadable: if the user can't see to confirm it, it's undone.  A nil
+confirm channel never fires, so the change is always reverted.
+*/
+func (s *Session) ApplyWithTimeout(
+	fn, revertTo XferFn, timeout time.Duration, confirm <-chan struct{},
+) error {
+	if err := s.SetGammaSync(fn); err != nil {
+		s.SetGammaSync(revertTo)
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-confirm:
+		return nil
+	case <-timer.C:
+	}
+	if err := s.SetGammaSync(revertTo); err != nil {
+		return err
+	}
+	return ErrNotConfirmed
+}
+
+// PerCrtcFn is like XferFn, but it is additionally passed the index of the
+// CRTC whose lookup table is being programmed.  CRTC indices are stable for the
+// lifetime of a Session.
+type PerCrtcFn func(crtcIndex int, ch Channel, in float64) (out float64)
+
+// SetGammaPerCrtc programs the CRTCs gamma lookup tables using a PerCrtcFn,
+// allowing each CRTC to receive a different transfer function.
+func (s *Session) SetGammaPerCrtc(fn PerCrtcFn) error {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	for crtcIdx, crtcGamma := range s.crtcs {
+		crtcIdx := crtcIdx
+		crtcGamma.fill(func(ch Channel, in float64) (out float64) {
+			return fn(crtcIdx, ch, in)
 		})
-		C.XRRSetCrtcGamma(s.cl.dpy, crtcGamma.crtc, crtcGamma.gamma)
+		s.cl.x.setCrtcGamma(crtcGamma.crtc, crtcGamma.gamma)
+	}
+	return s.cl.x.sync()
+}
+
+/*
+Restore programs the CRTCs gamma lookup tables with the values captured in a
+LookupTable.
+
+Unlike SetGamma(lt.XferFn()), which resamples the captured ramps through linear
+interpolation, Restore writes the captured values back verbatim to every CRTC
+whose index and ramp size match the one it was captured from, so the restore is
+exact.  Where the topology differs--e.g. a display has been hotplugged since the
+LookupTable was captured, or the CRTC wasn't captured at all (see
+GetLookupTable)--Restore falls back to lt.XferFn() for that CRTC.  Restore
+still programs every CRTC in that case, but then it returns an error wrapping
+ErrInexactRestore that lists the CRTCs that fell back, unless an X error
+occurred.
+*/
+func (s *Session) Restore(lt LookupTable) error {
+	if lt.IsZero() {
+		return fmt.Errorf("Cannot restore a zero LookupTable.")
+	}
+	var inexact []int
+	fallback := lt.XferFn()
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	for crtcIdx, crtcGamma := range s.crtcs {
+		if crtcIdx < len(lt.t[Red]) &&
+			len(lt.t[Red][crtcIdx]) == crtcGamma.size {
+			for ch := Red; ch < _channel_cardinality_; ch++ {
+				copy(crtcGamma.gamma.ramp(ch), lt.t[ch][crtcIdx])
+			}
+		} else {
+			crtcGamma.fill(fallback)
+			inexact = append(inexact, crtcIdx)
+		}
+		s.cl.x.setCrtcGamma(crtcGamma.crtc, crtcGamma.gamma)
 	}
+	if err := s.cl.x.sync(); err != nil {
+		return err
+	}
+	if len(inexact) > 0 {
+		return fmt.Errorf("CRTCs %v: %w", inexact, ErrInexactRestore)
+	}
+	return nil
 }
 
 /*
@@ -290,48 +1747,165 @@ GetLookupTable saves the current gamma lookup tables.
 
 NOTE: The non-primary CRTCs don't always read back correctly on some systems,
 so for the time being, GetLookupTable ignores all but the primary CRTC.  This
-is subject to change in a future minor release.
+is subject to change in a future minor release.  (See GetLookupTableAll.)
 */
 func (s *Session) GetLookupTable() (LookupTable, error) {
 	s.cl.check()
 	s.cl.mutex.Lock()
 	defer s.cl.mutex.Unlock()
-	var t [_channel_cardinality_][][]C.ushort
 	/*
 		BUG: The non-primary CRTCs don't always read back correctly.  I
 		haven't found any documentation of this behavior, and I haven't
 		tried to chase it through the video stack.  Ignoring all but
 		the primary CRTC should be sufficient for now.
-
-		(To undo this, "crtcs = len(s.crtcs)" instead of "crtcs = 1".)
 	*/
-	var crtcs int = 1
+	return s.getLookupTable(1)
+}
+
+/*
+GetLookupTableAll is like GetLookupTable, but it reads every CRTC, not just the
+primary one.  It's meant for callers who know that their setup reads back
+correctly.
+
+The misbehavior that GetLookupTable avoids hasn't been traced to particular
+drivers, so there's no list of affected hardware; before relying on
+GetLookupTableAll, check that the non-primary CRTCs read back what SetGamma
+wrote to them (e.g. by comparing with LookupTable.MaxDeviation).
+*/
+func (s *Session) GetLookupTableAll() (LookupTable, error) {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	return s.getLookupTable(len(s.crtcs))
+}
+
+/*
+GetCrtcGamma reads the raw Red, Green, and Blue ramps of the CRTC with the given
+index, in the same order as SetGammaRaw and SetGammaPerCrtc.  It's a lower-level
+inspection tool than GetLookupTable, meant for diagnosing which CRTCs read back
+correctly; the ramps are returned as they were read, not wrapped in a
+LookupTable.
+*/
+func (s *Session) GetCrtcGamma(crtcIndex int) ([3][]uint16, error) {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	var ramps [3][]uint16
+	if crtcIndex < 0 || crtcIndex >= len(s.crtcs) {
+		return ramps, fmt.Errorf("CRTC index %d is out of range; "+
+			"there are %d CRTCs.", crtcIndex, len(s.crtcs))
+	}
+	crtcGamma := s.crtcs[crtcIndex]
+	gamma := s.cl.x.getCrtcGamma(crtcGamma.crtc)
+	if gamma == nil {
+		return ramps, fmt.Errorf("CRTC %d: %w", crtcIndex, ErrCrtcRead)
+	}
+	defer gamma.free()
+	for ch := Red; ch < _channel_cardinality_; ch++ {
+		src := gamma.ramp(ch)
+		ramps[ch] = make([]uint16, len(src), len(src))
+		copy(ramps[ch], src)
+	}
+	return ramps, nil
+}
+
+/*
+EffectiveDepth estimates the number of bits per channel that the CRTC with the
+given index can actually display, so that callers can avoid detail (e.g. very
+fine gradients) that would be lost.  It's a best-effort heuristic:
+
+The starting point is the resolution of the CRTC's lookup table, the base-2
+logarithm of its size: 8 bits for the common 256-entry table, 10 for 1024
+entries, and so on.  Then, if any output that the CRTC drives has a "max bpc"
+property (which some drivers expose to cap the bit depth of the link to the
+monitor), the estimate is lowered to the smallest such value.  Neither source
+knows about dithering in the driver or the panel, nor about panels that accept
+more bits than they can show, so the true depth may differ.
+*/
+func (s *Session) EffectiveDepth(crtcIndex int) (int, error) {
+	s.cl.check()
+	s.cl.mutex.Lock()
+	defer s.cl.mutex.Unlock()
+	if crtcIndex < 0 || crtcIndex >= len(s.crtcs) {
+		return 0, fmt.Errorf("CRTC index %d is out of range; "+
+			"there are %d CRTCs.", crtcIndex, len(s.crtcs))
+	}
+	depth := bits.Len(uint(s.crtcs[crtcIndex].size)) - 1
+	outputs, err := s.outputCrtcs()
+	if err != nil {
+		return 0, err
+	}
+	for name, idx := range outputs {
+		if idx != crtcIndex {
+			continue
+		}
+		out, prop, _, err := s.outputProperty(name, "max bpc")
+		if errors.Is(err, ErrNoProperty) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		if v, ok := s.cl.x.getOutputProperty32(out, prop); ok &&
+			len(v) == 1 && v[0] > 0 && int(v[0]) < depth {
+			depth = int(v[0])
+		}
+	}
+	return depth, nil
+}
 
+// getLookupTable reads the first crtcs CRTCs.  The caller must hold the
+// Client's mutex.
+func (s *Session) getLookupTable(crtcs int) (LookupTable, error) {
+	var t [_channel_cardinality_][][]uint16
 	for ch := 0; ch < len(t); ch++ {
-		t[ch] = make([][]C.ushort, crtcs, crtcs)
+		t[ch] = make([][]uint16, crtcs, crtcs)
 	}
 	for crtcIdx, crtcGamma := range s.crtcs[0:crtcs] {
-		var gamma *C.XRRCrtcGamma
-		if gamma = C.XRRGetCrtcGamma(s.cl.dpy, crtcGamma.crtc); gamma == nil {
-			return LookupTable{}, fmt.Errorf("Error getting CrtcGamma.")
-		}
-		forGammaChannels(gamma, func(ch Channel, gv gammaVector) {
-			t[int(ch)][crtcIdx] = make([]C.ushort, crtcGamma.size, crtcGamma.size)
-			for idx := C.int(0); idx < crtcGamma.size; idx++ {
-				t[int(ch)][crtcIdx][idx] = gv[idx]
-			}
-		})
+		var gamma xgamma
+		if gamma = s.cl.x.getCrtcGamma(crtcGamma.crtc); gamma == nil {
+			return LookupTable{}, fmt.Errorf(
+				"CRTC %d: %w", crtcIdx, ErrCrtcRead)
+		}
+		size := len(gamma.ramp(Red))
+		if size != crtcGamma.size {
+			// The CRTC's size changed (e.g. a monitor was swapped).
+			s.adoptSize(crtcIdx, size)
+		}
+		for ch := Red; ch < _channel_cardinality_; ch++ {
+			t[ch][crtcIdx] = make([]uint16, size, size)
+			copy(t[ch][crtcIdx], gamma.ramp(ch))
+		}
+		gamma.free()
 	}
 	return LookupTable{t}, nil
 }
 
+/*
+ForeignUpdateSince reads the current lookup tables and compares them with
+baseline, which is typically a LookupTable saved after this process last
+called SetGamma.  It returns changed == true if they differ, which means that
+another process (e.g. redshift) has updated the lookup tables in the meantime.
+A zero baseline always counts as changed.
+
+This is the same check that animate.Animate uses to detect foreign updates.
+*/
+func (s *Session) ForeignUpdateSince(baseline LookupTable) (
+	changed bool, current LookupTable, err error,
+) {
+	if current, err = s.GetLookupTable(); err != nil {
+		return
+	}
+	changed = !current.Equals(baseline)
+	return
+}
+
 // LookupTable represents the state of the CRTC lookup tables at some point in
 // time.  Once created, a LookupTable instance does not refer to the underlying
 // resources from which it was derived, so its lifespan may exceed that of the
 // session from which it was created.
 type LookupTable struct {
 	// [channel][crtc][idx]
-	t [_channel_cardinality_][][]C.ushort
+	t [_channel_cardinality_][][]uint16
 }
 
 // Equals compares two LookupTable instances and returns true if their values
@@ -362,6 +1936,71 @@ func (lt LookupTable) Equals(o LookupTable) bool {
 	return true
 }
 
+/*
+Diff returns the signed differences between the primary CRTC's values in o and
+in lt, per channel and per entry: o's values minus lt's.  So if lt is a
+LookupTable saved before another process (e.g. redshift) changed the lookup
+tables and o was read afterward, Diff shows exactly what the other process did.
+
+Diff returns an error if the LookupTables' topologies differ (i.e. they hold
+different numbers of CRTCs, or ramps of different sizes), or if they're zero.
+*/
+func (lt LookupTable) Diff(o LookupTable) ([3][]int, error) {
+	var diff [3][]int
+	if lt.IsZero() || o.IsZero() {
+		return diff, fmt.Errorf("Cannot diff a zero LookupTable.")
+	}
+	for ch := range lt.t {
+		if len(lt.t[ch]) != len(o.t[ch]) {
+			return diff, fmt.Errorf("Channel %d: LookupTables hold %d "+
+				"and %d CRTCs.", ch, len(lt.t[ch]), len(o.t[ch]))
+		}
+		for crtc := range lt.t[ch] {
+			if len(lt.t[ch][crtc]) != len(o.t[ch][crtc]) {
+				return diff, fmt.Errorf("CRTC %d, channel %d: "+
+					"ramps have %d and %d values.", crtc, ch,
+					len(lt.t[ch][crtc]), len(o.t[ch][crtc]))
+			}
+		}
+	}
+	for ch := range lt.t {
+		a, b := lt.t[ch][0], o.t[ch][0]
+		diff[ch] = make([]int, len(a), len(a))
+		for idx := range a {
+			diff[ch][idx] = int(b[idx]) - int(a[idx])
+		}
+	}
+	return diff, nil
+}
+
+// MaxDeviation returns the largest absolute difference, normalized to [0, 1],
+// between the values in a LookupTable and the values that SetGamma(fn) would
+// have programmed.  If the LookupTable holds more than one CRTC, the largest
+// difference for each is averaged.  This can be used to detect whether a
+// foreign process has clobbered a gamma setting, and by how much.
+//
+// MaxDeviation returns 0 if the LookupTable is the zero value.
+func (lt LookupTable) MaxDeviation(fn XferFn) float64 {
+	var acc float64
+	for crtc := range lt.t[Red] {
+		var max float64
+		for ch := range lt.t {
+			lut := lt.t[ch][crtc]
+			for idx, v := range lut {
+				want := quantize(fn(Channel(ch),
+					float64(idx)/float64(len(lut))))
+				max = math.Max(max,
+					math.Abs(float64(v)-float64(want))/65535.0)
+			}
+		}
+		acc += max
+	}
+	if len(lt.t[Red]) == 0 {
+		return 0
+	}
+	return acc / float64(len(lt.t[Red]))
+}
+
 // IsZero returns true if a LookupTable is the zero value.
 func (lt LookupTable) IsZero() bool {
 	if lt.t[0] == nil {
@@ -370,26 +2009,150 @@ func (lt LookupTable) IsZero() bool {
 	return false
 }
 
-// XferFn constructs an XferFn instance from a LookupTable using linear
-// interpolation.
+// Channel returns a copy of the values for one channel of the primary CRTC,
+// or nil if the LookupTable is the zero value.
+func (lt LookupTable) Channel(ch Channel) []uint16 {
+	if len(lt.t[ch]) == 0 {
+		return nil
+	}
+	return append([]uint16(nil), lt.t[ch][0]...)
+}
+
+/*
+EstimateGamma fits a power law, out = coef * math.Pow(in, exp), to each channel
+of the primary CRTC by least squares in log-log space, and it returns each
+channel's exponent.  This is a rough diagnostic for the correction that some
+other tool (or this package's PowerFn) has programmed; a neutral ramp yields
+about 1, and PowerFn(exp) yields about exp.
+
+Inputs are taken to be idx/size, as SetGamma samples them.  Zero values, which
+have no logarithm, are ignored.  A channel's exponent is NaN if the
+LookupTable is the zero value or if its ramp isn't well approximated by a
+power law.
+*/
+func (lt LookupTable) EstimateGamma() (r, g, b float64) {
+	var exps [_channel_cardinality_]float64
+	for ch := range exps {
+		exps[ch] = math.NaN()
+		if len(lt.t[ch]) == 0 {
+			continue
+		}
+		ramp := lt.t[ch][0]
+		var n, sx, sy, sxx, sxy, syy float64
+		for idx, v := range ramp {
+			if idx == 0 || v == 0 {
+				continue
+			}
+			x := math.Log(float64(idx) / float64(len(ramp)))
+			y := math.Log(float64(v) / 65535.0)
+			n++
+			sx, sy = sx+x, sy+y
+			sxx, sxy, syy = sxx+x*x, sxy+x*y, syy+y*y
+		}
+		varX, varY, cov := n*sxx-sx*sx, n*syy-sy*sy, n*sxy-sx*sy
+		if n < 2 || varX <= 0 {
+			continue
+		}
+		if varY <= 0 {
+			// A constant ramp is a perfect fit with an exponent of 0.
+			exps[ch] = 0
+			continue
+		}
+		// Reject poor fits by their coefficient of determination.
+		if rSquared := cov * cov / (varX * varY); rSquared < 0.99 {
+			continue
+		}
+		exps[ch] = cov / varX
+	}
+	return exps[Red], exps[Green], exps[Blue]
+}
+
+// Apply returns a new LookupTable with the same topology as lt, in which fn has
+// been applied to each of lt's values.  (In other words, the new LookupTable
+// is a snapshot of lt.XferFn().Chain(fn), but without resampling lt.)
+func (lt LookupTable) Apply(fn XferFn) LookupTable {
+	var t [_channel_cardinality_][][]uint16
+	for ch := range lt.t {
+		if lt.t[ch] == nil {
+			continue
+		}
+		t[ch] = make([][]uint16, len(lt.t[ch]), len(lt.t[ch]))
+		for crtc, lut := range lt.t[ch] {
+			t[ch][crtc] = make([]uint16, len(lut), len(lut))
+			for idx, v := range lut {
+				out := fn(Channel(ch), float64(v)/65535.0)
+				t[ch][crtc][idx] = quantize(out)
+			}
+		}
+	}
+	return LookupTable{t}
+}
+
+/*
+XferFn constructs an XferFn instance from a LookupTable using linear
+interpolation.
+
+When the resulting XferFn is passed to SetGamma on the CRTC from which the
+LookupTable was captured, it reproduces the captured values, but any other CRTC
+receives a resampled approximation of them, and composing the XferFn with other
+functions re-quantizes the result.  Where fidelity matters, use Session.Restore
+to write a LookupTable back exactly, and LookupTable.Apply to modify it without
+resampling, as in s.Restore(lt.Apply(fn)).
+
+A zero LookupTable yields the identity function.
+*/
 func (lt LookupTable) XferFn() XferFn {
 	return func(ch Channel, in float64) (out float64) {
-		var t [][]C.ushort = lt.t[ch]
+		var t [][]uint16 = lt.t[ch]
 		var acc float64
 		var crtcs float64 = float64(len(t))
+		if len(t) == 0 {
+			// There's nothing to interpolate, e.g. because the
+			// LookupTable is zero.
+			return in
+		}
+		in = math.Max(math.Min(in, 1), 0)
 		for crtc := 0; crtc < len(t); crtc++ {
 			lut := t[crtc]
 			var base, frac float64 = math.Modf(in * float64(len(lut)))
 			// We evaluate base here instead of frac so that we
 			// don't have to worry about a bounds violation if
 			// frac == epsilon.
-			if int(base) < len(t)-1 {
+			if int(base) < len(lut)-1 {
 				acc += float64(lut[int(base)])*(1.0-frac) +
 					float64(lut[int(base)+1])*frac
 			} else {
-				acc += float64(lut[int(base)])
+				acc += float64(lut[len(lut)-1])
 			}
 		}
 		return acc / crtcs / 65535.0
 	}
 }
+
+/*
+XferFnNearest is like XferFn, but rather than interpolating, it returns the
+stored value nearest to each input.  Since SetGamma samples its XferFn at the
+same inputs, SetGamma(lt.XferFnNearest()) on the CRTC from which lt was
+captured writes back exactly the captured values, and comparisons made through
+XferFnNearest see the quantized values as they are, without interpolation
+blurring them.  If the LookupTable holds more than one CRTC, their values are
+averaged, as with XferFn.
+*/
+func (lt LookupTable) XferFnNearest() XferFn {
+	return func(ch Channel, in float64) (out float64) {
+		var t [][]uint16 = lt.t[ch]
+		if len(t) == 0 {
+			return in
+		}
+		in = math.Max(math.Min(in, 1), 0)
+		var acc float64
+		for _, lut := range t {
+			idx := int(math.Round(in * float64(len(lut))))
+			if idx > len(lut)-1 {
+				idx = len(lut) - 1
+			}
+			acc += float64(lut[idx])
+		}
+		return acc / float64(len(t)) / 65535.0
+	}
+}
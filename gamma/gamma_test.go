@@ -0,0 +1,1301 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSessionAllocFailure(t *testing.T) {
+	cl, x := newFakeClient(256, 256, 256)
+	defer cl.Close()
+	x.allocLimit = 2
+	s, err := cl.NewSession()
+	if !errors.Is(err, ErrGammaAlloc) {
+		t.Fatalf("expected ErrGammaAlloc, got %v", err)
+	}
+	if s != nil {
+		t.Fatal("a failed NewSession returned a Session")
+	}
+	if x.allocs != 0 {
+		t.Fatalf("%d XRRCrtcGamma allocations leaked", x.allocs)
+	}
+}
+
+func TestSRGB(t *testing.T) {
+	// (linear, encoded) reference pairs.
+	refs := [][2]float64{
+		{0, 0},
+		{0.0031308, 0.04045},
+		{0.001, 0.01292},
+		{0.0331048, 0.2},
+		{0.2140411, 0.5},
+		{0.6038273, 0.8},
+		{1, 1},
+	}
+	encode, decode := SRGBEncodeFn(), SRGBDecodeFn()
+	for _, ref := range refs {
+		if out := encode(Red, ref[0]); math.Abs(out-ref[1]) > 1e-6 {
+			t.Errorf("encode(%f): expected %f, got %f", ref[0], ref[1], out)
+		}
+		if out := decode(Red, ref[1]); math.Abs(out-ref[0]) > 1e-6 {
+			t.Errorf("decode(%f): expected %f, got %f", ref[1], ref[0], out)
+		}
+	}
+	for in := 0.0; in <= 1; in += 1.0 / 256 {
+		if out := decode(Green, encode(Green, in)); math.Abs(out-in) > 1e-9 {
+			t.Errorf("decode(encode(%f)) = %f", in, out)
+		}
+	}
+}
+
+func TestCheckRandR(t *testing.T) {
+	x := newFakeBackend(256)
+	if err := checkRandR(x); err != nil {
+		t.Fatal(err)
+	}
+	x.version = [2]int{1, 2}
+	if err := checkRandR(x); !errors.Is(err, ErrRandRVersion) {
+		t.Fatalf("expected ErrRandRVersion for XRandR 1.2, got %v", err)
+	}
+	x.version = [2]int{2, 0}
+	if err := checkRandR(x); err != nil {
+		t.Fatal(err)
+	}
+	x.noRandR = true
+	if err := checkRandR(x); !errors.Is(err, ErrNoRandR) {
+		t.Fatalf("expected ErrNoRandR, got %v", err)
+	}
+}
+
+func TestPerceptualPosterize(t *testing.T) {
+	fn := PerceptualPosterizeFn(3, 2)
+	// Levels at 0, 0.5² and 1.
+	for in, want := range map[float64]float64{
+		0: 0, 0.05: 0, 0.1: 0.25, 0.25: 0.25, 0.5: 0.25, 0.6: 1, 1: 1,
+	} {
+		if out := fn(Red, in); math.Abs(out-want) > 1e-9 {
+			t.Errorf("f(%f): expected %f, got %f", in, want, out)
+		}
+	}
+	if out := PosterizeFn(2)(Red, 0.4); out != 0 {
+		t.Errorf("expected 0, got %f", out)
+	}
+}
+
+func TestNightFn(t *testing.T) {
+	for _, strength := range []float64{-1, 0} {
+		fn := NightFn(strength)
+		if fn(Red, 1) != 1 || fn(Green, 1) != 1 || fn(Blue, 1) != 1 {
+			t.Fatalf("NightFn(%f) is not neutral", strength)
+		}
+	}
+	fn := NightFn(0.625)
+	if g, b := fn(Green, 1), fn(Blue, 1); math.Abs(g-0.885) > 1e-9 ||
+		math.Abs(b-0.705) > 1e-9 {
+		t.Fatalf("unexpected coefficients %f, %f", g, b)
+	}
+	if fn = NightFn(2); fn(Blue, 1) != 0.54 {
+		t.Fatalf("NightFn(2) did not clamp")
+	}
+}
+
+func TestSetGamma(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 1024)
+	defer done()
+
+	s.SetGamma(DimFn(0))
+	if x.sets != 2 {
+		t.Fatalf("expected 2 CRTC updates, got %d", x.sets)
+	}
+	for crtc := range x.ramps {
+		for ch := range x.ramps[crtc] {
+			for idx, v := range x.ramps[crtc][ch] {
+				if v != 0 {
+					t.Fatalf("crtc %d, channel %d, index %d: "+
+						"expected 0, got %d", crtc, ch, idx, v)
+				}
+			}
+		}
+	}
+}
+
+func TestSetGammaRounds(t *testing.T) {
+	const size = 256
+	s, x, done := newFakeSession(t, size)
+	defer done()
+
+	s.SetGamma(PowerFn(1))
+	for idx, v := range x.ramps[0][Red] {
+		want := uint16(math.Round(float64(idx) / size * 65535))
+		if v != want {
+			t.Fatalf("index %d: expected %d, got %d", idx, want, v)
+		}
+	}
+	s.SetGamma(func(ch Channel, in float64) float64 { return 2*in - 0.5 })
+	if ramp := x.ramps[0][Red]; ramp[0] != 0 || ramp[size-1] != 65535 {
+		t.Fatal("out-of-range values were not clamped")
+	}
+}
+
+func TestGetLookupTablePrimaryOnly(t *testing.T) {
+	s, _, done := newFakeSession(t, 256, 1024)
+	defer done()
+
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ch := range lt.t {
+		if len(lt.t[ch]) != 1 || len(lt.t[ch][0]) != 256 {
+			t.Fatalf("channel %d: unexpected topology", ch)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+
+	x.ramps[0][Green][17] = 1234
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetGamma(PowerFn(2))
+	if lt2, _ := s.GetLookupTable(); lt2.Equals(lt) {
+		t.Fatal("SetGamma had no effect")
+	}
+	if err = s.Restore(lt); err != nil {
+		t.Fatal(err)
+	}
+	if lt2, _ := s.GetLookupTable(); !lt2.Equals(lt) {
+		t.Fatal("Restore was not exact")
+	}
+}
+
+func TestRestoreInexact(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 1024)
+	defer done()
+
+	// GetLookupTable captures only the primary CRTC, so the other one
+	// falls back to the resampled XferFn.
+	s.SetGamma(DimFn(0.5))
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetGamma(IdentityFn())
+	err = s.Restore(lt)
+	if !errors.Is(err, ErrInexactRestore) ||
+		!strings.Contains(err.Error(), "[1]") {
+		t.Fatalf("expected ErrInexactRestore for CRTC 1, got %v", err)
+	}
+	if x.ramps[0][Red][255] != lt.t[Red][0][255] {
+		t.Fatal("Restore didn't write the primary CRTC back exactly")
+	}
+	if v := x.ramps[1][Red][512]; v < 16380 || v > 16390 {
+		t.Fatalf("expected CRTC 1 to be resampled, got %d", v)
+	}
+}
+
+func TestSetGammaPerCrtc(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 256)
+	defer done()
+
+	s.SetGammaPerCrtc(func(crtc int, ch Channel, in float64) float64 {
+		return float64(crtc)
+	})
+	if x.ramps[0][Blue][128] != 0 || x.ramps[1][Blue][128] != 65535 {
+		t.Fatal("CRTCs were not programmed independently")
+	}
+}
+
+func TestSessionCloseFreesGamma(t *testing.T) {
+	cl, x := newFakeClient(256, 256)
+	defer cl.Close()
+	s, err := cl.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if x.allocs != 0 {
+		t.Fatalf("%d XRRCrtcGamma allocations leaked", x.allocs)
+	}
+}
+
+func TestSetGammaDithered(t *testing.T) {
+	s, x, done := newFakeSession(t, 1024)
+	defer done()
+	var err error
+
+	if err = s.SetGammaDithered(IdentityFn(), 0); err == nil {
+		t.Fatal("expected an error for a zero bit depth")
+	}
+	if err = s.SetGammaDithered(DimFn(0.3), 6); err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for idx, v := range x.ramps[0][Red] {
+		level := math.Round(float64(v) * 63 / 65535)
+		if uint16(math.Round(level*65535/63)) != v {
+			t.Fatalf("index %d: %d is not a 6-bit level", idx, v)
+		}
+		sum += float64(v) / 65535.0
+	}
+	// The dithered ramp should average out to the undithered ramp.
+	const want = 0.3 * 0.5
+	if mean := sum / 1024; mean < want-0.005 || mean > want+0.005 {
+		t.Fatalf("expected a mean of about %f, got %f", want, mean)
+	}
+}
+
+func TestNewScreenSession(t *testing.T) {
+	cl, _ := newFakeClient(256)
+	defer cl.Close()
+	if n := cl.ScreenCount(); n != 1 {
+		t.Fatalf("expected 1 screen, got %d", n)
+	}
+	if _, err := cl.NewScreenSession(1); err == nil {
+		t.Fatal("expected an error for a nonexistent screen")
+	}
+	s, err := cl.NewScreenSession(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+}
+
+func TestSetGammaMulti(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 256, 256)
+	defer done()
+	var err error
+
+	if err = s.SetGammaMulti(map[string]XferFn{
+		"OUT-0": DimFn(0),
+		"OUT-9": DimFn(0),
+	}); !errors.Is(err, ErrNoOutput) {
+		t.Fatalf("expected ErrNoOutput, got %v", err)
+	}
+	if x.sets != 0 {
+		t.Fatal("a failed SetGammaMulti programmed the CRTCs")
+	}
+	if err = s.SetGammaMulti(map[string]XferFn{
+		"OUT-0": DimFn(0),
+		"OUT-2": DimFn(1),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if x.sets != 2 {
+		t.Fatalf("expected 2 CRTC updates, got %d", x.sets)
+	}
+	if x.ramps[0][Red][255] != 0 || x.ramps[2][Red][255] == 0 {
+		t.Fatal("outputs were not programmed with their own XferFns")
+	}
+}
+
+func TestLookupTableApply(t *testing.T) {
+	lt := LookupTable{[_channel_cardinality_][][]uint16{
+		{{0, 32768, 65535}},
+		{{0, 32768, 65535}},
+		{{0, 32768, 65535}},
+	}}
+	applied := lt.Apply(DimFn(0.5))
+	if got := applied.t[Green][0]; got[0] != 0 || got[1] != 16384 ||
+		got[2] != 32768 {
+		t.Fatalf("unexpected values %v", got)
+	}
+	if lt.t[Green][0][2] != 65535 {
+		t.Fatal("Apply modified the original LookupTable")
+	}
+}
+
+func TestLookupTableChannel(t *testing.T) {
+	s, _, done := newFakeSession(t, 4, 8)
+	defer done()
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blue := lt.Channel(Blue)
+	if len(blue) != 4 {
+		t.Fatalf("expected the primary CRTC's 4 values, got %v", blue)
+	}
+	blue[0] = 1
+	if lt.Channel(Blue)[0] != 0 {
+		t.Fatal("Channel returned an alias of the LookupTable's values")
+	}
+	if (LookupTable{}).Channel(Red) != nil {
+		t.Fatal("expected nil from a zero LookupTable")
+	}
+}
+
+func TestLookupTableDiff(t *testing.T) {
+	s, x, done := newFakeSession(t, 4)
+	defer done()
+	before, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.ramps[0][Green][2] -= 100
+	after, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := before.Diff(after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff[Green]) != 4 || diff[Green][2] != -100 ||
+		diff[Red][2] != 0 {
+		t.Fatalf("unexpected diff: %v", diff)
+	}
+
+	x.resize(8)
+	if err = s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if after, err = s.GetLookupTable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = before.Diff(after); err == nil {
+		t.Fatal("Diff accepted LookupTables of different sizes")
+	}
+}
+
+func TestRandRVersion(t *testing.T) {
+	cl, _ := newFakeClient(256)
+	defer cl.Close()
+	major, minor, err := cl.RandRVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if major != 1 || minor != 5 {
+		t.Fatalf("expected 1.5, got %d.%d", major, minor)
+	}
+	if err = requireRandR(cl.x, 1, 6, "Testing"); err == nil {
+		t.Fatal("expected an error requiring XRandR 1.6")
+	}
+}
+
+func TestLookupTableMaxDeviation(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+
+	s.SetGamma(DimFn(0.5))
+	x.ramps[0][Blue][100] += 6554
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := lt.MaxDeviation(DimFn(0.5)); math.Abs(d-0.1) > 1e-4 {
+		t.Fatalf("expected a deviation of 0.1, got %f", d)
+	}
+	if d := (LookupTable{}).MaxDeviation(DimFn(0.5)); d != 0 {
+		t.Fatalf("expected no deviation for a zero LookupTable, got %f", d)
+	}
+}
+
+func TestSetGammaRaw(t *testing.T) {
+	s, x, done := newFakeSession(t, 4, 2)
+	defer done()
+	var err error
+
+	if err = s.SetGammaRaw([][3][]uint16{
+		{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}},
+		{{1, 2}, {3, 4}, {5, 6, 7}},
+	}); err == nil {
+		t.Fatal("expected an error for a mismatched ramp size")
+	}
+	if x.sets != 0 {
+		t.Fatal("a failed SetGammaRaw programmed the CRTCs")
+	}
+	if err = s.SetGammaRaw([][3][]uint16{
+		{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}},
+		{{1, 2}, {3, 4}, {5, 6}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if x.ramps[0][Blue][3] != 12 || x.ramps[1][Green][0] != 3 {
+		t.Fatal("the ramps were not written verbatim")
+	}
+}
+
+func TestSetGammaVerified(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+	var err error
+
+	if err = s.SetGammaVerified(PowerFn(2), 0); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a driver that truncates to 8 bits.
+	x.mangle = func(v uint16) uint16 { return v &^ 0xff }
+	if err = s.SetGammaVerified(PowerFn(2), 0); !errors.Is(err, ErrVerify) {
+		t.Fatalf("expected ErrVerify, got %v", err)
+	}
+	if err = s.SetGammaVerified(PowerFn(2), 0xff); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+	var err error
+
+	x.resize(1024, 256)
+	if err = s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.crtcs) != 2 || s.crtcs[0].size != 1024 {
+		t.Fatal("Refresh did not pick up the new CRTCs")
+	}
+	if x.allocs != 2 {
+		t.Fatalf("expected 2 XRRCrtcGamma allocations, got %d", x.allocs)
+	}
+	s.SetGamma(DimFn(0))
+	if x.ramps[0][Red][1023] != 0 || x.ramps[1][Red][255] != 0 {
+		t.Fatal("SetGamma did not program the new CRTCs")
+	}
+}
+
+func TestLookupTableXferFnRoundTrip(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+
+	s.SetGamma(SRGBDecodeFn())
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := lt.XferFn()
+	s.SetGamma(fn)
+	if lt2, _ := s.GetLookupTable(); !lt2.Equals(lt) {
+		t.Fatal("the round trip through XferFn was not exact")
+	}
+	last := float64(x.ramps[0][Red][255]) / 65535
+	if out := fn(Red, 1); out != last {
+		t.Fatalf("expected f(1) = %f, got %f", last, out)
+	}
+	if out := fn(Red, 0.5/256); out <= 0 || out >= fn(Red, 1.0/256) {
+		t.Fatalf("f(0.5/256) = %f was not interpolated", out)
+	}
+}
+
+func TestForeignUpdateSince(t *testing.T) {
+	s, x, done := newFakeSession(t, 16)
+	defer done()
+	s.SetGamma(DimFn(0.5))
+	baseline, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, _, err := s.ForeignUpdateSince(baseline); err != nil || changed {
+		t.Fatalf("expected no change, got %v (%v)", changed, err)
+	}
+	x.ramps[0][Green][3] = 1234
+	changed, current, err := s.ForeignUpdateSince(baseline)
+	if err != nil || !changed {
+		t.Fatalf("expected a change, got %v (%v)", changed, err)
+	}
+	if current.Channel(Green)[3] != 1234 {
+		t.Fatal("expected the current LookupTable to reflect the update")
+	}
+}
+
+func TestRestoreDefault(t *testing.T) {
+	cl, x := newFakeClient(256, 1024)
+	defer cl.Close()
+	s, err := cl.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetGamma(DimFn(0.25))
+	s.Close()
+	if err = cl.RestoreDefault(); err != nil {
+		t.Fatal(err)
+	}
+	for crtc, size := range []int{256, 1024} {
+		if v := x.ramps[crtc][Red][size/2]; v != 32768 {
+			t.Fatalf("CRTC %d: expected 32768, got %d", crtc, v)
+		}
+	}
+	if x.allocs != 0 {
+		t.Fatalf("%d gamma allocations leaked", x.allocs)
+	}
+
+	// RestoreDefault waits for the X server without reading the lookup
+	// tables back, and it reports X errors.
+	x.failReads = true
+	if err = cl.RestoreDefault(); err != nil {
+		t.Fatal(err)
+	}
+	badValue := &XError{Code: 2, Request: 140, Minor: 24, Text: "BadValue"}
+	x.xerr = badValue
+	if err = cl.RestoreDefault(); !errors.Is(err, badValue) {
+		t.Fatalf("expected the X error, got %v", err)
+	}
+}
+
+func TestTemperatureCoefficientsNormalized(t *testing.T) {
+	for kelvin := 1000.0; kelvin <= 40000; kelvin += 100 {
+		r, g, b := TemperatureCoefficients(kelvin)
+		if max := math.Max(r, math.Max(g, b)); max != 1 {
+			t.Fatalf("%gK: expected a maximum coefficient of 1, got %g",
+				kelvin, max)
+		}
+	}
+}
+
+func TestEvaluateRamp(t *testing.T) {
+	s, x, done := newFakeSession(t, 1024)
+	defer done()
+	fn := SRGBEncodeFn().Chain(TemperatureFn(4500))
+	s.SetGamma(fn)
+	for ch := Red; ch < _channel_cardinality_; ch++ {
+		ramp := EvaluateRamp(fn, ch, 1024)
+		for idx, v := range ramp {
+			if x.ramps[0][ch][idx] != v {
+				t.Fatalf("channel %d, index %d: SetGamma wrote %d, "+
+					"EvaluateRamp returned %d",
+					ch, idx, x.ramps[0][ch][idx], v)
+			}
+		}
+	}
+}
+
+func BenchmarkEvaluateRamp(b *testing.B) {
+	fn := SRGBEncodeFn().Chain(TemperatureFn(4500))
+	for i := 0; i < b.N; i++ {
+		EvaluateRamp(fn, Green, 1024)
+	}
+}
+
+func TestSetColorMatrix(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 256)
+	defer done()
+	x.atoms = []string{"CTM"}
+	x.props = map[xoutput]map[xatom][]uint32{1: {1: nil}}
+	var err error
+
+	if err = s.SetColorMatrix("OUT-0", [9]float64{
+		1, 0, 0,
+		0, 1, 0,
+		0, -0.5, 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data := x.props[1][1]
+	if len(data) != 18 || data[0] != 0 || data[1] != 1 ||
+		data[14] != 0x80000000 || data[15] != 0x80000000 || data[16] != 0 ||
+		data[17] != 1 {
+		t.Fatalf("unexpected CTM encoding %#x", data)
+	}
+	err = s.SetColorMatrix("OUT-1", [9]float64{})
+	if !errors.Is(err, ErrNoProperty) {
+		t.Fatalf("expected ErrNoProperty, got %v", err)
+	}
+	err = s.SetColorMatrix("OUT-2", [9]float64{})
+	if !errors.Is(err, ErrNoOutput) {
+		t.Fatalf("expected ErrNoOutput, got %v", err)
+	}
+}
+
+func TestNoCrtcs(t *testing.T) {
+	cl, _ := newFakeClient()
+	defer cl.Close()
+	if _, err := cl.NewSession(); !errors.Is(err, ErrNoCrtcs) {
+		t.Fatalf("expected ErrNoCrtcs, got %v", err)
+	}
+	if err := cl.RestoreDefault(); err != nil {
+		t.Fatalf("RestoreDefault failed without CRTCs: %v", err)
+	}
+	var empty LookupTable
+	empty.t[Red] = [][]uint16{}
+	for _, lt := range []LookupTable{{}, empty} {
+		if out := lt.XferFn()(Red, 0.5); out != 0.5 {
+			t.Fatalf("expected an empty LookupTable to yield the "+
+				"identity function, got %f", out)
+		}
+	}
+}
+
+func TestSupportsGamma(t *testing.T) {
+	cl, x := newFakeClient(256, 256)
+	defer cl.Close()
+	x.ramps[0][Red][128] = 1234
+	if ok, err := cl.SupportsGamma(); err != nil || !ok {
+		t.Fatalf("expected gamma support, got %v (%v)", ok, err)
+	}
+	if x.ramps[0][Red][128] != 1234 {
+		t.Fatal("SupportsGamma didn't restore the original ramps")
+	}
+
+	// The other CRTCs' calibration must survive the probe.
+	for idx := range x.ramps[1][Green] {
+		x.ramps[1][Green][idx] = uint16(idx * 64)
+	}
+	sets := x.sets
+	if ok, err := cl.SupportsGamma(); err != nil || !ok {
+		t.Fatalf("expected gamma support, got %v (%v)", ok, err)
+	}
+	if x.ramps[1][Green][200] != 12800 || x.sets != sets+2 {
+		t.Fatal("SupportsGamma touched a secondary CRTC")
+	}
+
+	// A server that ignores gamma writes.
+	x.mangle = func(v uint16) uint16 { return 0 }
+	if ok, err := cl.SupportsGamma(); err != nil || ok {
+		t.Fatalf("expected no gamma support, got %v (%v)", ok, err)
+	}
+
+	// A server without any CRTCs.
+	x.resize()
+	if ok, err := cl.SupportsGamma(); err != nil || ok {
+		t.Fatalf("expected no gamma support, got %v (%v)", ok, err)
+	}
+}
+
+func TestSplineFn(t *testing.T) {
+	points := [][2]float64{{0, 0}, {0.1, 0.3}, {0.5, 0.35}, {1, 1}}
+	fn, err := SplineFn(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range points {
+		if out := fn(Red, p[0]); math.Abs(out-p[1]) > 1e-9 {
+			t.Fatalf("f(%g) = %g, expected %g", p[0], out, p[1])
+		}
+	}
+	prev := fn(Green, 0)
+	for idx := 1; idx <= 1000; idx++ {
+		out := fn(Green, float64(idx)/1000)
+		if out < prev {
+			t.Fatalf("spline isn't monotonic at %g", float64(idx)/1000)
+		}
+		prev = out
+	}
+
+	for _, bad := range [][][2]float64{
+		{{0, 0}},
+		{{0, 0}, {0.5, 0.5}, {0.5, 1}},
+		{{0.5, 0}, {0.2, 1}},
+		{{0, 0}, {1, 1.5}},
+	} {
+		if _, err = SplineFn(bad); err == nil {
+			t.Fatalf("expected an error for %v", bad)
+		}
+	}
+}
+
+func TestSetOutputBrightness(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 256)
+	defer done()
+	x.atoms = []string{"Brightness"}
+	x.props = map[xoutput]map[xatom][]uint32{1: {1: {0}}}
+	x.ranges = map[xatom][2]int64{1: {0, 200}}
+	var err error
+
+	if err = s.SetOutputBrightness("OUT-0", 0.25); err != nil {
+		t.Fatal(err)
+	}
+	if v := x.props[1][1][0]; v != 50 {
+		t.Fatalf("expected 50, got %d", v)
+	}
+	err = s.SetOutputBrightness("OUT-1", 0.25)
+	if !errors.Is(err, ErrNoProperty) {
+		t.Fatalf("expected ErrNoProperty, got %v", err)
+	}
+	x.ignorePropWrites = true
+	err = s.SetOutputBrightness("OUT-0", 1)
+	if !errors.Is(err, ErrPropertyWrite) {
+		t.Fatalf("expected ErrPropertyWrite, got %v", err)
+	}
+	x.version = [2]int{1, 1}
+	err = s.SetOutputBrightness("OUT-0", 1)
+	if !errors.Is(err, ErrRandRVersion) {
+		t.Fatalf("expected ErrRandRVersion, got %v", err)
+	}
+}
+
+func TestPowerFnClamped(t *testing.T) {
+	fn := PowerFnClamped(0.01, 0.1, 4)
+	if out, want := fn(Red, 0.5), math.Pow(0.5, 0.1); out != want {
+		t.Fatalf("expected %g, got %g", want, out)
+	}
+	fn = PowerFnClamped(10, 0.1, 4)
+	if out, want := fn(Red, 0.5), math.Pow(0.5, 4); out != want {
+		t.Fatalf("expected %g, got %g", want, out)
+	}
+}
+
+func TestSetGammaExcept(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 256, 256)
+	defer done()
+	var err error
+	if err = s.SetGammaExcept([]string{"OUT-1", "HDMI-9"},
+		DimFn(0)); err != nil {
+		t.Fatal(err)
+	}
+	if x.ramps[0][Red][255] != 0 || x.ramps[2][Red][255] != 0 {
+		t.Fatal("an included CRTC wasn't programmed")
+	}
+	if x.ramps[1][Red][255] == 0 {
+		t.Fatal("an excluded CRTC was programmed")
+	}
+}
+
+func TestLookupTableEstimateGamma(t *testing.T) {
+	s, _, done := newFakeSession(t, 256)
+	defer done()
+	s.SetGamma(PowerFn(2.2).Chain(DimFn(0.8)))
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, b := lt.EstimateGamma(); math.Abs(r-2.2) > 0.01 ||
+		math.Abs(b-2.2) > 0.01 {
+		t.Fatalf("expected about 2.2, got %g and %g", r, b)
+	}
+	s.SetGamma(func(ch Channel, in float64) float64 { return 1 - in })
+	if lt, err = s.GetLookupTable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, g, _ := lt.EstimateGamma(); !math.IsNaN(g) {
+		t.Fatalf("expected NaN for an inverted ramp, got %g", g)
+	}
+	if r, _, _ := (LookupTable{}).EstimateGamma(); !math.IsNaN(r) {
+		t.Fatalf("expected NaN for a zero LookupTable, got %g", r)
+	}
+}
+
+func TestXferFnMasked(t *testing.T) {
+	fn := DimFn(0).Masked(0.2, 0.4, 0.1)
+	for _, c := range []struct{ in, want float64 }{
+		{0.05, 0.05},
+		{0.3, 0},
+		{0.45, 0.225},
+		{0.6, 0.6},
+	} {
+		if out := fn(Red, c.in); math.Abs(out-c.want) > 1e-9 {
+			t.Fatalf("f(%g) = %g, expected %g", c.in, out, c.want)
+		}
+	}
+	hard := DimFn(0).Masked(0.2, 0.4, 0)
+	if out := hard(Red, 0.41); out != 0.41 {
+		t.Fatalf("expected a hard edge, got %g", out)
+	}
+}
+
+func TestGetLookupTableAll(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 1024)
+	defer done()
+	x.ramps[1][Blue][1000] = 42
+	lt, err := s.GetLookupTableAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lt.t[Blue]) != 2 || lt.t[Blue][1][1000] != 42 {
+		t.Fatal("GetLookupTableAll didn't read the second CRTC")
+	}
+	x.ramps[1][Blue][1000] = 0
+	if err = s.Restore(lt); err != nil {
+		t.Fatal(err)
+	}
+	if x.ramps[1][Blue][1000] != 42 {
+		t.Fatal("Restore didn't write the second CRTC back exactly")
+	}
+}
+
+func TestGetCrtcGamma(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 1024)
+	defer done()
+	x.ramps[1][Green][1000] = 42
+	ramps, err := s.GetCrtcGamma(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ramps[Red]) != 1024 || ramps[Green][1000] != 42 {
+		t.Fatal("GetCrtcGamma didn't read the second CRTC")
+	}
+	ramps[Green][1000] = 0
+	if x.ramps[1][Green][1000] != 42 {
+		t.Fatal("GetCrtcGamma returned ramps that alias the CRTC's buffer")
+	}
+	for _, idx := range []int{-1, 2} {
+		if _, err = s.GetCrtcGamma(idx); err == nil {
+			t.Fatalf("GetCrtcGamma accepted out-of-range index %d", idx)
+		}
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	fn := SRGBEncodeFn().Chain(TemperatureFn(3400))
+	memo := Memoize(fn, 1024)
+	for ch := Red; ch < _channel_cardinality_; ch++ {
+		for idx := 0; idx <= 100; idx++ {
+			in := float64(idx) / 100
+			if diff := math.Abs(memo(ch, in) - fn(ch, in)); diff > 1e-3 {
+				t.Fatalf("channel %d, f(%g): off by %g", ch, in, diff)
+			}
+		}
+	}
+	if out := memo(Red, 2); out != fn(Red, 1) {
+		t.Fatalf("expected inputs to be clamped, got %g", out)
+	}
+}
+
+func BenchmarkMemoize(b *testing.B) {
+	fn := Memoize(SRGBEncodeFn().Chain(TemperatureFn(4500)), 1024)
+	for i := 0; i < b.N; i++ {
+		EvaluateRamp(fn, Green, 1024)
+	}
+}
+
+func TestXferFnWhen(t *testing.T) {
+	enabled := false
+	fn := DimFn(0.5).When(func() bool { return enabled })
+	if out := fn(Green, 0.8); out != 0.8 {
+		t.Fatalf("expected pass-through, got %g", out)
+	}
+	enabled = true
+	if out := fn(Green, 0.8); out != 0.4 {
+		t.Fatalf("expected 0.4, got %g", out)
+	}
+}
+
+func TestSetGammaIfChanged(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 256)
+	defer done()
+	s.SetGamma(PowerFn(2))
+	sets := x.sets
+	if s.SetGammaIfChanged(PowerFn(2), 0) || x.sets != sets {
+		t.Fatal("SetGammaIfChanged reprogrammed an unchanged ramp")
+	}
+	if s.SetGammaIfChanged(PowerFn(2.001), 256) || x.sets != sets {
+		t.Fatal("SetGammaIfChanged ignored the tolerance")
+	}
+	if !s.SetGammaIfChanged(PowerFn(2.001), 0) || x.sets != sets+2 {
+		t.Fatal("SetGammaIfChanged didn't program a changed ramp")
+	}
+	if want := quantize(math.Pow(0.5, 2.001)); x.ramps[1][Red][128] != want {
+		t.Fatalf("expected %d, got %d", want, x.ramps[1][Red][128])
+	}
+}
+
+func TestSetGammaSizeChange(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+
+	// SetGamma mustn't cost a round trip per CRTC.
+	queries := x.sizeQueries
+	s.SetGamma(DimFn(0.5))
+	if x.sizeQueries != queries {
+		t.Fatal("SetGamma queried the lookup table sizes")
+	}
+
+	// Swap the monitor for one with a larger ramp, without a Refresh.  The
+	// Session adopts the new size when it reads the lookup table.
+	x.resize(1024)
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lt.Channel(Red)) != 1024 {
+		t.Fatal("GetLookupTable truncated the new ramp")
+	}
+	s.SetGamma(DimFn(0))
+	if s.crtcs[0].size != 1024 || x.ramps[0][Red][1023] != 0 {
+		t.Fatal("SetGamma did not adapt to the new ramp size")
+	}
+	if x.allocs != 1 {
+		t.Fatalf("expected 1 XRRCrtcGamma allocation, got %d", x.allocs)
+	}
+
+	// The X server rejects a wrongly sized lookup table, and SetGammaSync
+	// adopts the new size and tries again.
+	x.resize(512)
+	if err = s.SetGammaSync(DimFn(0.5)); err != nil {
+		t.Fatal(err)
+	}
+	if s.crtcs[0].size != 512 || x.ramps[0][Red][256] != quantize(0.25) {
+		t.Fatal("SetGammaSync did not adapt to the new ramp size")
+	}
+	if err = s.SetGammaSync(IdentityFn()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCrtcSizeCache(t *testing.T) {
+	cl, x := newFakeClient(256, 1024)
+	defer cl.Close()
+	for i := 0; i < 3; i++ {
+		s, err := cl.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+	}
+	if x.sizeQueries != 2 {
+		t.Fatalf("expected 2 size queries, got %d", x.sizeQueries)
+	}
+
+	s, err := cl.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	x.resize(512, 1024)
+	if err = s.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if s.crtcs[0].size != 512 {
+		t.Fatal("Refresh used a stale cached size")
+	}
+
+	// Hotplugging advances the configuration timestamp, which
+	// invalidates the cache.
+	x.resize(128, 1024)
+	s2, err := cl.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if s2.crtcs[0].size != 128 {
+		t.Fatal("NewSession used a cached size after a hotplug")
+	}
+	raw := make([][3][]uint16, 2)
+	for idx, size := range []int{128, 1024} {
+		for ch := range raw[idx] {
+			raw[idx][ch] = EvaluateRamp(IdentityFn(), Channel(ch), size)
+		}
+	}
+	if err = s2.SetGammaRaw(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	// A size change that doesn't advance it needs InvalidateCrtcCache.
+	x.resize(64, 1024)
+	x.stamp--
+	cl.InvalidateCrtcCache()
+	s3, err := cl.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s3.Close()
+	if s3.crtcs[0].size != 64 {
+		t.Fatal("NewSession used a cached size after InvalidateCrtcCache")
+	}
+}
+
+func TestOutputTransform(t *testing.T) {
+	s, x, done := newFakeSession(t, 256, 256)
+	defer done()
+	x.rotations = map[xcrtc]int{2: xrotate90 | xreflectX}
+	for name, want := range map[string]string{
+		"OUT-0": "normal",
+		"OUT-1": "left reflect-x",
+	} {
+		if got, err := s.OutputTransform(name); err != nil || got != want {
+			t.Fatalf("%s: expected %q, got %q (%v)", name, want, got,
+				err)
+		}
+	}
+	if _, err := s.OutputTransform("OUT-2"); !errors.Is(err, ErrNoOutput) {
+		t.Fatalf("expected ErrNoOutput, got %v", err)
+	}
+}
+
+func TestLookupTableXferFnNearest(t *testing.T) {
+	s, x, done := newFakeSession(t, 4)
+	defer done()
+	copy(x.ramps[0][Red], []uint16{0, 100, 60000, 65535})
+	lt, err := s.GetLookupTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := lt.XferFnNearest()
+	for in, want := range map[float64]uint16{
+		0.2: 100, 0.3: 100, 0.4: 60000, 0.9: 65535,
+	} {
+		if out := quantize(fn(Red, in)); out != want {
+			t.Fatalf("f(%g): expected %d, got %d", in, want, out)
+		}
+	}
+	s.SetGamma(DimFn(0))
+	s.SetGamma(fn)
+	if x.ramps[0][Red][1] != 100 || x.ramps[0][Red][2] != 60000 {
+		t.Fatalf("SetGamma didn't write back exactly: %v",
+			x.ramps[0][Red])
+	}
+	if (LookupTable{}).XferFnNearest()(Red, 0.5) != 0.5 {
+		t.Fatal("expected a zero LookupTable to yield the identity function")
+	}
+}
+
+func TestXError(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+	cl := s.cl
+	var err error
+	badValue := &XError{Code: 2, Request: 140, Minor: 24, Text: "BadValue"}
+
+	x.xerr = badValue
+	s.SetGamma(IdentityFn())
+	if err = cl.Sync(); err != badValue {
+		t.Fatalf("expected Sync to return the X error, got %v", err)
+	}
+	if err = cl.Sync(); err != nil {
+		t.Fatalf("expected the X error to be reported once, got %v", err)
+	}
+	x.xerr = badValue
+	if err = s.SetGammaPerCrtc(func(int, Channel, float64) float64 {
+		return 0
+	}); err != badValue {
+		t.Fatalf("expected SetGammaPerCrtc to return the X error, got %v",
+			err)
+	}
+}
+
+func TestProviders(t *testing.T) {
+	cl, x := newFakeClient(256, 256)
+	defer cl.Close()
+	x.providers = []xproviderInfo{
+		{name: "iGPU", crtcs: []xcrtc{1}},
+		// The second CRTC is part of the screen; the third isn't.
+		{name: "dGPU", crtcs: []xcrtc{2, 3}},
+	}
+	providers, err := cl.Providers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 2 || providers[1].Name != "dGPU" ||
+		providers[1].Crtcs != 2 || len(providers[1].CrtcIndices) != 1 ||
+		providers[1].CrtcIndices[0] != 1 {
+		t.Fatalf("unexpected providers: %+v", providers)
+	}
+
+	x.version = [2]int{1, 3}
+	if _, err = cl.Providers(); !errors.Is(err, ErrRandRVersion) {
+		t.Fatalf("expected ErrRandRVersion, got %v", err)
+	}
+}
+
+func TestNewSessionRetry(t *testing.T) {
+	cl, x := newFakeClient(256)
+	defer cl.Close()
+	x.resourceFailures = 2
+	s, err := cl.NewSessionRetry(3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	s.Close()
+
+	x.resourceFailures = 3
+	if _, err = cl.NewSessionRetry(3, time.Millisecond); !errors.Is(err,
+		ErrScreenResources) {
+		t.Fatalf("expected ErrScreenResources, got %v", err)
+	}
+	x.resourceFailures = 1
+	if _, err = cl.NewSessionRetry(0, time.Millisecond); err == nil {
+		t.Fatal("expected a single attempt")
+	}
+}
+
+func TestApplyWithTimeout(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+	var err error
+
+	confirm := make(chan struct{})
+	close(confirm)
+	if err = s.ApplyWithTimeout(DimFn(0.5), IdentityFn(), time.Hour,
+		confirm); err != nil {
+		t.Fatal(err)
+	}
+	if x.ramps[0][Red][128] != quantize(0.25) {
+		t.Fatal("the confirmed change was not kept")
+	}
+
+	err = s.ApplyWithTimeout(DimFn(0), IdentityFn(), time.Millisecond, nil)
+	if !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("expected ErrNotConfirmed, got %v", err)
+	}
+	if x.ramps[0][Red][128] != quantize(0.5) {
+		t.Fatal("the unconfirmed change was not reverted")
+	}
+
+	// A (possibly stale) X error mustn't leave the change unguarded.
+	x.xerr = &XError{Code: 2}
+	err = s.ApplyWithTimeout(DimFn(0), DimFn(0.5), time.Hour, nil)
+	var xerr *XError
+	if !errors.As(err, &xerr) {
+		t.Fatalf("expected an *XError, got %v", err)
+	}
+	if x.ramps[0][Red][128] != quantize(0.25) {
+		t.Fatal("the change was not reverted after an X error")
+	}
+}
+
+func TestInvert(t *testing.T) {
+	inv, err := Invert(PowerFn(2.2), Green, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []float64{0, 0.1, 0.5, 0.9, 1} {
+		if out := PowerFn(2.2).Chain(inv)(Red, in); math.Abs(out-in) > 1e-3 {
+			t.Fatalf("inv(fn(%g)) = %g", in, out)
+		}
+	}
+	inv, err = Invert(func(ch Channel, in float64) float64 {
+		return 1 - in/2
+	}, Red, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := inv(Blue, 0.75); math.Abs(out-0.5) > 1e-9 {
+		t.Fatalf("expected 0.5, got %g", out)
+	}
+	if out := inv(Blue, 0); out != 1 {
+		t.Fatalf("expected an out-of-range input to clamp, got %g", out)
+	}
+	for _, fn := range []XferFn{DimFn(0), func(ch Channel, in float64) float64 {
+		return math.Sin(in * math.Pi)
+	}} {
+		if _, err = Invert(fn, Red, 256); err == nil {
+			t.Fatal("Invert accepted a non-invertible XferFn")
+		}
+	}
+}
+
+func TestPerceptualDimFn(t *testing.T) {
+	if out := PerceptualDimFn(0.5)(Red, 1); math.Abs(out-0.25) > 1e-9 {
+		t.Fatalf("expected a coefficient of 0.25, got %g", out)
+	}
+	if out := PerceptualDimFnExp(0.5, 1)(Red, 1); out != 0.5 {
+		t.Fatalf("expected exp = 1 to match DimFn, got %g", out)
+	}
+	if PerceptualDimFn(2)(Red, 1) != 1 || PerceptualDimFn(0)(Red, 1) != 0 {
+		t.Fatal("perceivedFraction wasn't clamped")
+	}
+}
+
+func TestClientHold(t *testing.T) {
+	cl, x := newFakeClient(256)
+	closing, release, err := cl.Hold()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan struct{})
+	go func() {
+		cl.Close()
+		close(closed)
+	}()
+	<-closing
+	if _, _, err = cl.Hold(); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", err)
+	}
+	// The holder may still use the Client on its way out.
+	s, err := cl.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetGamma(IdentityFn())
+	s.Close()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the Hold was released")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	release()
+	<-closed
+	if !x.closed || !cl.Closed() {
+		t.Fatal("the Client wasn't closed")
+	}
+	if _, _, err = cl.Hold(); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestEffectiveDepth(t *testing.T) {
+	s, x, done := newFakeSession(t, 1024, 1024, 256)
+	defer done()
+	x.atoms = []string{"max bpc"}
+	x.props = map[xoutput]map[xatom][]uint32{1: {1: {8}}, 2: {1: {12}}}
+	for idx, want := range []int{8, 10, 8} {
+		depth, err := s.EffectiveDepth(idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if depth != want {
+			t.Fatalf("CRTC %d: expected %d bits, got %d", idx, want,
+				depth)
+		}
+	}
+	if _, err := s.EffectiveDepth(3); err == nil {
+		t.Fatal("EffectiveDepth accepted an out-of-range index")
+	}
+}
+
+func TestClipReport(t *testing.T) {
+	fn := func(ch Channel, in float64) float64 { return in*2 - 0.5 }
+	low, high := ClipReport(fn, Red, 9)
+	if low != 2 || high != 2 {
+		t.Fatalf("expected (2, 2), got (%d, %d)", low, high)
+	}
+	if low, high = ClipReport(PowerFn(2), Red, 256); low != 0 || high != 0 {
+		t.Fatalf("expected no clipping, got (%d, %d)", low, high)
+	}
+}
+
+func TestSetGammaSync(t *testing.T) {
+	s, x, done := newFakeSession(t, 256)
+	defer done()
+	var err error
+	if err = s.SetGammaSync(DimFn(0)); err != nil {
+		t.Fatal(err)
+	}
+	if x.ramps[0][Red][255] != 0 {
+		t.Fatal("SetGammaSync didn't program the lookup tables")
+	}
+	x.xerr = &XError{Code: 2}
+	var xerr *XError
+	if err = s.SetGammaSync(DimFn(0)); !errors.As(err, &xerr) {
+		t.Fatalf("expected an *XError, got %v", err)
+	}
+}
+
+func TestQuantizeToSize(t *testing.T) {
+	fn := QuantizeToSize(PowerFn(2), 4)
+	for _, c := range []struct{ in, want float64 }{
+		{0, 0},
+		{0.4, 0.0625},
+		{0.5, 0.25},
+		{1, 0.5625},
+		{2, 0.5625},
+	} {
+		want := float64(quantize(c.want)) / 65535
+		if out := fn(Green, c.in); out != want {
+			t.Fatalf("at %g: expected %g, got %g", c.in, want, out)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+Guard applies fn to the CRTCs of the display's default X screen and then holds
+it there: every pollInterval, it checks whether another process has changed the
+lookup tables (see Session.ForeignUpdateSince), and if so, it applies fn again.
+This is meant for setups like kiosks, where a setting must stick no matter what
+else runs.  An error is returned if fn can't be applied in the first place or
+if pollInterval isn't positive.
+
+Guard runs in its own goroutine until stop is called or cl is closed (see
+Client.Hold); stop waits for it to exit and doesn't restore the lookup tables.
+Calling stop more than once is a no-op.  Errors that occur while polling (e.g.
+a failed read) are ignored, and the check is retried at the next poll.
+*/
+func Guard(cl *Client, fn XferFn, pollInterval time.Duration) (
+	stop func(), err error,
+) {
+	var (
+		s        *Session
+		baseline LookupTable
+		closing  <-chan struct{}
+		release  func()
+	)
+	if pollInterval <= 0 {
+		err = fmt.Errorf("Guard's poll interval must be positive, got %v.",
+			pollInterval)
+		return
+	}
+	if closing, release, err = cl.Hold(); err != nil {
+		return
+	}
+	if s, err = cl.NewSession(); err != nil {
+		release()
+		return
+	}
+	s.SetGamma(fn)
+	if baseline, err = s.GetLookupTable(); err != nil {
+		s.Close()
+		release()
+		return
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer release()
+		defer s.Close()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-closing:
+				return
+			case <-ticker.C:
+			}
+			changed, _, err := s.ForeignUpdateSince(baseline)
+			if err != nil || !changed {
+				continue
+			}
+			s.SetGamma(fn)
+			if lt, err := s.GetLookupTable(); err == nil {
+				baseline = lt
+			}
+		}
+	}()
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+		})
+	}
+	return
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	cl, x := newFakeClient(256)
+	defer cl.Close()
+	stop, err := Guard(cl, DimFn(0.5), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := quantize(0.25)
+	cl.mutex.Lock()
+	if x.ramps[0][Red][128] != want {
+		t.Fatal("Guard didn't apply fn")
+	}
+	// Overwrite the lookup tables, as another process would.
+	x.ramps[0][Red][128] = 0
+	cl.mutex.Unlock()
+
+	var restored bool
+	for try := 0; try < 100 && !restored; try++ {
+		time.Sleep(time.Millisecond)
+		cl.mutex.Lock()
+		restored = x.ramps[0][Red][128] == want
+		cl.mutex.Unlock()
+	}
+	if !restored {
+		t.Fatal("Guard didn't reapply fn after a foreign update")
+	}
+	stop()
+	stop()
+	x.ramps[0][Red][128] = 0
+	time.Sleep(5 * time.Millisecond)
+	if x.ramps[0][Red][128] != 0 {
+		t.Fatal("Guard kept running after stop")
+	}
+}
+
+func TestGuardPollInterval(t *testing.T) {
+	cl, x := newFakeClient(256)
+	defer cl.Close()
+	if _, err := Guard(cl, DimFn(0), 0); err == nil {
+		t.Fatal("Guard accepted a zero poll interval")
+	}
+	if x.sets != 0 {
+		t.Fatal("Guard applied fn despite the invalid poll interval")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+ReadLUT reads a 1D lookup table in a simple text format from r, and returns an
+XferFn that interpolates linearly across its entries.  The first and last
+entries correspond to inputs of 0 and 1.
+
+Each line holds one entry: either a single value, which is used for all three
+channels, or three values (Red, Green, and Blue) separated by commas or
+whitespace, as in a CSV file.  Every entry must have the same number of values.
+Blank lines and lines beginning with "#" are ignored.
+
+Values are normally in [0, 1].  A table is instead taken to hold 16-bit values,
+which are scaled by 1/65535, if all of its values are integers and at least one
+exceeds 1; a table that mixes fractional values with values above 1 is
+rejected, as are values above 65535.  So a 16-bit table whose values are all 0
+or 1 can't be told apart from a normalized one, and is read as normalized.
+*/
+func ReadLUT(r io.Reader) (XferFn, error) {
+	var (
+		table   [_channel_cardinality_][]float64
+		columns int
+		lineNo  int
+		max     float64
+		integer bool = true
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || c == ';' || c == ' ' || c == '\t'
+		})
+		if len(fields) != 1 && len(fields) != len(table) {
+			return nil, fmt.Errorf("Line %d: expected 1 or %d values, "+
+				"got %d.", lineNo, len(table), len(fields))
+		}
+		if columns == 0 {
+			columns = len(fields)
+		} else if len(fields) != columns {
+			return nil, fmt.Errorf("Line %d: expected %d values, "+
+				"got %d.", lineNo, columns, len(fields))
+		}
+		for ch := range table {
+			field := fields[0]
+			if columns > 1 {
+				field = fields[ch]
+			}
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil || v < 0 || v > 65535 {
+				return nil, fmt.Errorf("Line %d: invalid value %q.",
+					lineNo, field)
+			}
+			max = math.Max(max, v)
+			integer = integer && v == math.Trunc(v)
+			table[ch] = append(table[ch], v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(table[Red]) < 2 {
+		return nil, fmt.Errorf("A LUT needs at least 2 entries, got %d.",
+			len(table[Red]))
+	}
+	if max > 1 {
+		if !integer {
+			return nil, fmt.Errorf("The LUT mixes values above 1 " +
+				"with fractional values.")
+		}
+		for ch := range table {
+			for idx := range table[ch] {
+				table[ch][idx] /= 65535
+			}
+		}
+	}
+	return func(ch Channel, in float64) (out float64) {
+		lut := table[ch]
+		in = math.Max(math.Min(in, 1), 0)
+		base, frac := math.Modf(in * float64(len(lut)-1))
+		if int(base) >= len(lut)-1 {
+			return lut[len(lut)-1]
+		}
+		return lut[int(base)]*(1-frac) + lut[int(base)+1]*frac
+	}, nil
+}
+
+/*
+WriteLUT samples fn at size points and writes the result to w as a 1D lookup
+table in the format read by ReadLUT: one line per entry, with a single value
+(taken from the Red channel) if perChannel is false, or comma-separated Red,
+Green, and Blue values if it's true.
+
+The points are spaced evenly over [0, 1] (inclusive), as ReadLUT expects, and
+the values are clamped and rounded to 16 bits exactly as SetGamma would
+program them, then written normalized to [0, 1] in full precision.  So
+ReadLUT(WriteLUT(fn)) reproduces those values exactly at the sampled points
+and interpolates linearly between them.
+*/
+func WriteLUT(w io.Writer, fn XferFn, size int, perChannel bool) error {
+	if size < 2 {
+		return fmt.Errorf("A LUT needs at least 2 entries, got %d.", size)
+	}
+	channels := Channel(1)
+	if perChannel {
+		channels = _channel_cardinality_
+	}
+	var buf bytes.Buffer
+	for idx := 0; idx < size; idx++ {
+		in := float64(idx) / float64(size-1)
+		for ch := Red; ch < channels; ch++ {
+			if ch > Red {
+				buf.WriteByte(',')
+			}
+			out := float64(quantize(fn(ch, in))) / 65535
+			buf.WriteString(strconv.FormatFloat(out, 'g', -1, 64))
+		}
+		buf.WriteByte('\n')
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestReadLUT(t *testing.T) {
+	fn, err := ReadLUT(strings.NewReader("# ramp\n0\n0.25\n\n1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := fn(Green, 0.25); math.Abs(out-0.125) > 1e-9 {
+		t.Fatalf("expected f(0.25) = 0.125, got %f", out)
+	}
+	if out := fn(Blue, 1); out != 1 {
+		t.Fatalf("expected f(1) = 1, got %f", out)
+	}
+
+	fn, err = ReadLUT(strings.NewReader(
+		"0, 0, 0\n32768, 16384, 65535\n65535, 65535, 65535\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := fn(Green, 0.5); math.Abs(out-0.25) > 1e-4 {
+		t.Fatalf("expected 16-bit values to be scaled, got %f", out)
+	}
+	if out := fn(Blue, 0.5); out != 1 {
+		t.Fatalf("expected per-channel columns, got %f", out)
+	}
+
+	for _, bad := range []string{"", "0.5\n", "0\n0 1\n", "0\nx\n",
+		"0\n1 1\n", "0.5\n2\n", "0\n65536\n"} {
+		if _, err = ReadLUT(strings.NewReader(bad)); err == nil {
+			t.Fatalf("ReadLUT accepted %q", bad)
+		}
+	}
+}
+
+func TestWriteLUT(t *testing.T) {
+	var buf bytes.Buffer
+	fn := TemperatureFn(3400)
+	if err := WriteLUT(&buf, fn, 4, true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[0] != "0,0,0" {
+		t.Fatalf("unexpected LUT: %q", buf.String())
+	}
+	read, err := ReadLUT(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx := 0; idx < 4; idx++ {
+		in := float64(idx) / 3
+		for ch := Red; ch < _channel_cardinality_; ch++ {
+			want := float64(quantize(fn(ch, in))) / 65535
+			if got := read(ch, in); got != want {
+				t.Fatalf("channel %d at %g: expected %g, got %g",
+					ch, in, want, got)
+			}
+		}
+	}
+
+	// Values are rounded to 16 bits, as SetGamma rounds them.
+	buf.Reset()
+	if err = WriteLUT(&buf, DimFn(0.5), 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "0\n0.5000076295109483\n" {
+		t.Fatalf("expected 32768/65535, got %q", s)
+	}
+
+	// A very dark curve mustn't be mistaken for 16-bit integers.
+	buf.Reset()
+	dark := DimFn(1.0 / 65535)
+	if err = WriteLUT(&buf, dark, 256, false); err != nil {
+		t.Fatal(err)
+	}
+	if read, err = ReadLUT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := read(Green, 1); out != 1.0/65535 {
+		t.Fatalf("the dark LUT didn't read back, got %g", out)
+	}
+	if out := read(Green, 127.0/255.0); out != 0 {
+		t.Fatalf("the dark LUT didn't read back, got %g", out)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// MarshalBinary encodes the LookupTable, implementing
+// encoding.BinaryMarshaler.  The encoding holds the number of CRTCs, followed
+// by each CRTC's lookup table size and its Red, Green, and Blue ramps, all as
+// big-endian integers.
+func (lt LookupTable) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(lt.t[Red])))
+	for crtc := range lt.t[Red] {
+		binary.Write(&buf, binary.BigEndian, uint32(len(lt.t[Red][crtc])))
+		for ch := range lt.t {
+			binary.Write(&buf, binary.BigEndian, lt.t[ch][crtc])
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a LookupTable encoded by MarshalBinary, implementing
+// encoding.BinaryUnmarshaler.  It returns an error wrapping ErrCorruptSnapshot
+// if data isn't a valid encoding, or if it has no CRTCs or a CRTC with fewer
+// than 2 lookup table entries, in which case lt is unchanged.
+func (lt *LookupTable) UnmarshalBinary(data []byte) error {
+	var (
+		t     [_channel_cardinality_][][]uint16
+		crtcs uint32
+	)
+	r := bytes.NewReader(data)
+	if binary.Read(r, binary.BigEndian, &crtcs) != nil {
+		return fmt.Errorf("Truncated LookupTable: %w", ErrCorruptSnapshot)
+	}
+	if crtcs == 0 {
+		return fmt.Errorf("LookupTable has no CRTCs: %w",
+			ErrCorruptSnapshot)
+	}
+	for crtc := uint32(0); crtc < crtcs; crtc++ {
+		var size uint32
+		if binary.Read(r, binary.BigEndian, &size) != nil ||
+			int64(size)*2*int64(len(t)) > int64(r.Len()) {
+			return fmt.Errorf("Truncated LookupTable: %w",
+				ErrCorruptSnapshot)
+		}
+		if size < 2 {
+			return fmt.Errorf("CRTC %d's lookup table has %d entries: "+
+				"%w", crtc, size, ErrCorruptSnapshot)
+		}
+		for ch := range t {
+			ramp := make([]uint16, size)
+			binary.Read(r, binary.BigEndian, ramp)
+			t[ch] = append(t[ch], ramp)
+		}
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes after LookupTable: %w",
+			r.Len(), ErrCorruptSnapshot)
+	}
+	lt.t = t
+	return nil
+}
+
+const (
+	// snapshotMagic begins every serialized SnapshotStore.
+	snapshotMagic = "XRRGSNP1"
+	// Lengths beyond these are taken as signs of corruption, rather than
+	// allocated.
+	maxSnapshotName = 1 << 12
+	maxSnapshotData = 1 << 26
+)
+
+/*
+SnapshotStore holds a set of named LookupTables (e.g. "work", "night", and
+"movie" profiles) and reads and writes them as a single file.  Names are kept in
+the order in which they were added.  The zero value is an empty store.
+
+In the file, each entry's LookupTable is encoded by MarshalBinary and is
+followed by a checksum, so that a damaged entry is detected and can be skipped
+without losing the rest (see ReadSnapshotStore).
+*/
+type SnapshotStore struct {
+	names  []string
+	tables map[string]LookupTable
+}
+
+// Add adds a LookupTable to the store under the given name.  An error is
+// returned, and the store is unchanged, if the name is empty or already in use
+// (see Remove) or if lt is a zero LookupTable.
+func (st *SnapshotStore) Add(name string, lt LookupTable) error {
+	if name == "" {
+		return fmt.Errorf("A snapshot's name must not be empty.")
+	}
+	if lt.IsZero() {
+		return fmt.Errorf("Cannot store a zero LookupTable.")
+	}
+	if _, ok := st.tables[name]; ok {
+		return fmt.Errorf("A snapshot named %q already exists.", name)
+	}
+	if st.tables == nil {
+		st.tables = make(map[string]LookupTable)
+	}
+	st.names = append(st.names, name)
+	st.tables[name] = lt
+	return nil
+}
+
+// Remove removes the named LookupTable from the store, and reports whether it
+// was there.
+func (st *SnapshotStore) Remove(name string) bool {
+	if _, ok := st.tables[name]; !ok {
+		return false
+	}
+	delete(st.tables, name)
+	for idx, n := range st.names {
+		if n == name {
+			st.names = append(st.names[:idx], st.names[idx+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Get returns the named LookupTable, and whether it's in the store.
+func (st *SnapshotStore) Get(name string) (LookupTable, bool) {
+	lt, ok := st.tables[name]
+	return lt, ok
+}
+
+// Names lists the names of the store's LookupTables, in the order in which
+// they were added.
+func (st *SnapshotStore) Names() []string {
+	return append([]string(nil), st.names...)
+}
+
+// Write writes the store to w.
+func (st *SnapshotStore) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(st.names)))
+	for _, name := range st.names {
+		data, err := st.tables[name].MarshalBinary()
+		if err != nil {
+			return err
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(len(name)))
+		buf.WriteString(name)
+		binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+		buf.Write(data)
+		binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(data))
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+/*
+ReadSnapshotStore reads a SnapshotStore written by SnapshotStore.Write.
+
+Damage is handled as gracefully as the format allows.  An entry whose checksum
+doesn't match, or whose LookupTable can't be decoded, is skipped, as is a
+second entry with the same name as an earlier one.  If the file is truncated,
+or an entry's length is implausible, the entries before it are kept.  In each
+case, the returned store holds every entry that was read successfully, and the
+returned error wraps ErrCorruptSnapshot and describes what was skipped.  I/O
+errors from r are returned as they are.
+*/
+func ReadSnapshotStore(r io.Reader) (*SnapshotStore, error) {
+	st := new(SnapshotStore)
+	var (
+		magic   [len(snapshotMagic)]byte
+		entries uint32
+		skipped []string
+	)
+	// read wraps an unexpected EOF, which means the file was truncated.
+	read := func(data interface{}) error {
+		err := binary.Read(r, binary.BigEndian, data)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("Truncated snapshot file: %w",
+				ErrCorruptSnapshot)
+		}
+		return err
+	}
+	if err := read(&magic); err != nil {
+		return nil, err
+	}
+	if string(magic[:]) != snapshotMagic {
+		return nil, fmt.Errorf("Not a snapshot file: %w",
+			ErrCorruptSnapshot)
+	}
+	if err := read(&entries); err != nil {
+		return nil, err
+	}
+	for idx := uint32(0); idx < entries; idx++ {
+		var nameLen, dataLen, sum uint32
+		if err := read(&nameLen); err != nil {
+			return st, err
+		}
+		if nameLen > maxSnapshotName {
+			return st, fmt.Errorf("Entry %d's name is too long: %w",
+				idx, ErrCorruptSnapshot)
+		}
+		name := make([]byte, nameLen)
+		if err := read(name); err != nil {
+			return st, err
+		}
+		if err := read(&dataLen); err != nil {
+			return st, err
+		}
+		if dataLen > maxSnapshotData {
+			return st, fmt.Errorf("Entry %q is too long: %w", name,
+				ErrCorruptSnapshot)
+		}
+		data := make([]byte, dataLen)
+		if err := read(data); err != nil {
+			return st, err
+		}
+		if err := read(&sum); err != nil {
+			return st, err
+		}
+		var lt LookupTable
+		switch {
+		case crc32.ChecksumIEEE(data) != sum:
+			skipped = append(skipped, fmt.Sprintf(
+				"%q (bad checksum)", name))
+		case lt.UnmarshalBinary(data) != nil:
+			skipped = append(skipped, fmt.Sprintf(
+				"%q (undecodable)", name))
+		case st.Add(string(name), lt) != nil:
+			skipped = append(skipped, fmt.Sprintf(
+				"%q (duplicate or invalid)", name))
+		}
+	}
+	if len(skipped) > 0 {
+		return st, fmt.Errorf("Skipped %d snapshots: %s: %w",
+			len(skipped), strings.Join(skipped, ", "),
+			ErrCorruptSnapshot)
+	}
+	return st, nil
+}
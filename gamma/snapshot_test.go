@@ -0,0 +1,136 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// testTable returns a LookupTable with two CRTCs of different sizes.
+func testTable(fn XferFn) LookupTable {
+	var lt LookupTable
+	for ch := range lt.t {
+		lt.t[ch] = [][]uint16{
+			EvaluateRamp(fn, Channel(ch), 4),
+			EvaluateRamp(fn, Channel(ch), 8),
+		}
+	}
+	return lt
+}
+
+func TestLookupTableMarshalBinary(t *testing.T) {
+	lt := testTable(TemperatureFn(3000))
+	data, err := lt.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got LookupTable
+	if err = got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equals(lt) {
+		t.Fatal("the LookupTable didn't round-trip")
+	}
+	for _, bad := range [][]byte{
+		nil,
+		data[:len(data)-1],
+		append(data, 0),
+		{0, 0, 0, 0},
+		{0, 0, 0, 1, 0, 0, 0, 0},
+	} {
+		err = got.UnmarshalBinary(bad)
+		if !errors.Is(err, ErrCorruptSnapshot) {
+			t.Fatalf("expected ErrCorruptSnapshot, got %v", err)
+		}
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	var st SnapshotStore
+	work, night := testTable(IdentityFn()), testTable(NightFn(1))
+	if err := st.Add("work", work); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Add("night", night); err != nil {
+		t.Fatal(err)
+	}
+	if st.Add("work", night) == nil || st.Add("", work) == nil ||
+		st.Add("zero", LookupTable{}) == nil {
+		t.Fatal("Add accepted an invalid snapshot")
+	}
+	var buf bytes.Buffer
+	if err := st.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	read, err := ReadSnapshotStore(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := read.Names(); len(names) != 2 || names[0] != "work" ||
+		names[1] != "night" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+	if lt, ok := read.Get("night"); !ok || !lt.Equals(night) {
+		t.Fatal("the night snapshot didn't round-trip")
+	}
+
+	// Damage the first entry's data; the second should survive.
+	damaged := append([]byte(nil), data...)
+	damaged[len(snapshotMagic)+4+4+len("work")+4+8]++
+	read, err = ReadSnapshotStore(bytes.NewReader(damaged))
+	if !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("expected ErrCorruptSnapshot, got %v", err)
+	}
+	if names := read.Names(); len(names) != 1 || names[0] != "night" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+
+	// An entry whose checksum is intact but whose table is degenerate.
+	var degenerate bytes.Buffer
+	degenerate.WriteString(snapshotMagic)
+	entry := []byte{0, 0, 0, 1, 0, 0, 0, 0}
+	binary.Write(&degenerate, binary.BigEndian, []uint32{1, 4})
+	degenerate.WriteString("zero")
+	binary.Write(&degenerate, binary.BigEndian, uint32(len(entry)))
+	degenerate.Write(entry)
+	binary.Write(&degenerate, binary.BigEndian, crc32.ChecksumIEEE(entry))
+	read, err = ReadSnapshotStore(&degenerate)
+	if !errors.Is(err, ErrCorruptSnapshot) || len(read.Names()) != 0 {
+		t.Fatalf("expected the entry to be skipped, got %v, %v",
+			read.Names(), err)
+	}
+
+	read, err = ReadSnapshotStore(bytes.NewReader(data[:len(data)-1]))
+	if !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("expected ErrCorruptSnapshot, got %v", err)
+	}
+	if names := read.Names(); len(names) != 1 || names[0] != "work" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+	if _, err = ReadSnapshotStore(bytes.NewReader(nil)); err == nil {
+		t.Fatal("ReadSnapshotStore accepted an empty file")
+	}
+
+	if !read.Remove("work") || read.Remove("work") || len(read.Names()) != 0 {
+		t.Fatal("Remove didn't remove the snapshot exactly once")
+	}
+}
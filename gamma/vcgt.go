@@ -0,0 +1,176 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+/*
+VCGT holds the contents of a "video card gamma table" (vcgt) tag, the
+private-but-ubiquitous ICC profile tag in which calibration tools store the
+lookup tables that a profile loader should program into the CRTCs.
+
+A vcgt tag holds either a table of per-channel values (IsFormula is false) or
+per-channel power-law parameters (IsFormula is true).
+*/
+type VCGT struct {
+	IsFormula bool
+	// For tables: the values for each channel, scaled to 16 bits.  The
+	// first and last values correspond to inputs of 0 and 1.
+	Table [_channel_cardinality_][]uint16
+	// For formulas: f(ch, in) = Min[ch] + (Max[ch]-Min[ch]) * in^Gamma[ch].
+	Gamma, Min, Max [_channel_cardinality_]float64
+}
+
+// ReadVCGT reads a vcgt tag from r, which may contain either a complete ICC
+// profile or a bare vcgt tag.
+func ReadVCGT(r io.Reader) (v VCGT, err error) {
+	var data []byte
+	if data, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+	if len(data) >= 40 && string(data[36:40]) == "acsp" {
+		if data, err = findICCTag(data, "vcgt"); err != nil {
+			return
+		}
+	}
+	err = v.parse(data)
+	return
+}
+
+// findICCTag returns the data of the tag with signature sig in an ICC profile.
+func findICCTag(profile []byte, sig string) ([]byte, error) {
+	const tagTable = 128
+	if len(profile) < tagTable+4 {
+		return nil, fmt.Errorf("Truncated ICC profile.")
+	}
+	count := binary.BigEndian.Uint32(profile[tagTable:])
+	for idx := uint32(0); idx < count; idx++ {
+		entry := tagTable + 4 + 12*int(idx)
+		if entry+12 > len(profile) {
+			return nil, fmt.Errorf("Truncated ICC tag table.")
+		}
+		if string(profile[entry:entry+4]) != sig {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(profile) {
+			return nil, fmt.Errorf("ICC tag %q is out of bounds.", sig)
+		}
+		return profile[offset : offset+size], nil
+	}
+	return nil, fmt.Errorf("ICC profile has no %q tag.", sig)
+}
+
+func (v *VCGT) parse(data []byte) error {
+	const (
+		tableType   = 0
+		formulaType = 1
+	)
+	var hdr struct {
+		Sig      [4]byte
+		Reserved uint32
+		Type     uint32
+	}
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return fmt.Errorf("Truncated vcgt tag.")
+	}
+	if string(hdr.Sig[:]) != "vcgt" {
+		return fmt.Errorf("Not a vcgt tag.")
+	}
+	switch hdr.Type {
+	case tableType:
+		var table struct {
+			Channels, Count, Size uint16
+		}
+		if err := binary.Read(r, binary.BigEndian, &table); err != nil {
+			return fmt.Errorf("Truncated vcgt table.")
+		}
+		if table.Channels != 1 && table.Channels != 3 ||
+			table.Size != 1 && table.Size != 2 || table.Count < 2 {
+			return fmt.Errorf("Unsupported vcgt table layout "+
+				"(%d channels, %d entries, %d bytes per entry).",
+				table.Channels, table.Count, table.Size)
+		}
+		for ch := 0; ch < int(table.Channels); ch++ {
+			v.Table[ch] = make([]uint16, table.Count)
+			for idx := range v.Table[ch] {
+				if table.Size == 1 {
+					b, err := r.ReadByte()
+					if err != nil {
+						return fmt.Errorf("Truncated vcgt table.")
+					}
+					v.Table[ch][idx] = uint16(b) * 257
+				} else if err := binary.Read(r, binary.BigEndian,
+					&v.Table[ch][idx]); err != nil {
+					return fmt.Errorf("Truncated vcgt table.")
+				}
+			}
+		}
+		if table.Channels == 1 {
+			v.Table[Green], v.Table[Blue] = v.Table[Red], v.Table[Red]
+		}
+	case formulaType:
+		var formula [_channel_cardinality_][3]int32
+		if err := binary.Read(r, binary.BigEndian, &formula); err != nil {
+			return fmt.Errorf("Truncated vcgt formula.")
+		}
+		v.IsFormula = true
+		for ch := range formula {
+			// The parameters are s15Fixed16Numbers.
+			v.Gamma[ch] = float64(formula[ch][0]) / 65536
+			v.Min[ch] = float64(formula[ch][1]) / 65536
+			v.Max[ch] = float64(formula[ch][2]) / 65536
+		}
+	default:
+		return fmt.Errorf("Unknown vcgt type %d.", hdr.Type)
+	}
+	return nil
+}
+
+// Size returns the number of entries in a table vcgt, or 0 for a formula.
+func (v VCGT) Size() int {
+	return len(v.Table[Red])
+}
+
+// XferFn constructs an XferFn instance from a VCGT, using linear
+// interpolation for tables.
+func (v VCGT) XferFn() XferFn {
+	if v.IsFormula {
+		return func(ch Channel, in float64) (out float64) {
+			return v.Min[ch] + (v.Max[ch]-v.Min[ch])*
+				math.Pow(math.Max(in, 0), v.Gamma[ch])
+		}
+	}
+	return func(ch Channel, in float64) (out float64) {
+		table := v.Table[ch]
+		in = math.Max(math.Min(in, 1), 0)
+		base, frac := math.Modf(in * float64(len(table)-1))
+		if int(base) >= len(table)-1 {
+			return float64(table[len(table)-1]) / 65535.0
+		}
+		return (float64(table[int(base)])*(1-frac) +
+			float64(table[int(base)+1])*frac) / 65535.0
+	}
+}
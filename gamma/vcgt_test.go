@@ -0,0 +1,79 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestReadVCGTTable(t *testing.T) {
+	var tag bytes.Buffer
+	tag.WriteString("vcgt")
+	binary.Write(&tag, binary.BigEndian, []uint32{0, 0})
+	binary.Write(&tag, binary.BigEndian, []uint16{1, 3, 2})
+	binary.Write(&tag, binary.BigEndian, []uint16{0, 16384, 65535})
+
+	// Wrap the tag in a minimal ICC profile.
+	profile := make([]byte, 128)
+	copy(profile[36:], "acsp")
+	var buf bytes.Buffer
+	buf.Write(profile)
+	binary.Write(&buf, binary.BigEndian, uint32(1))
+	buf.WriteString("vcgt")
+	binary.Write(&buf, binary.BigEndian, []uint32{128 + 4 + 12,
+		uint32(tag.Len())})
+	buf.Write(tag.Bytes())
+
+	v, err := ReadVCGT(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.IsFormula || v.Size() != 3 {
+		t.Fatalf("expected a 3-entry table, got %+v", v)
+	}
+	fn := v.XferFn()
+	if out := fn(Blue, 0.25); math.Abs(out-0.125) > 1e-4 {
+		t.Fatalf("expected f(0.25) = 0.125, got %f", out)
+	}
+	if out := fn(Green, 1); out != 1 {
+		t.Fatalf("expected f(1) = 1, got %f", out)
+	}
+}
+
+func TestReadVCGTFormula(t *testing.T) {
+	var tag bytes.Buffer
+	tag.WriteString("vcgt")
+	binary.Write(&tag, binary.BigEndian, []uint32{0, 1})
+	for ch := 0; ch < 3; ch++ {
+		binary.Write(&tag, binary.BigEndian, []int32{2 << 16, 0, 1 << 15})
+	}
+	v, err := ReadVCGT(&tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.IsFormula {
+		t.Fatal("expected a formula")
+	}
+	if out := v.XferFn()(Red, 0.5); out != 0.125 {
+		t.Fatalf("expected f(0.5) = 0.125, got %f", out)
+	}
+	if _, err = ReadVCGT(bytes.NewReader([]byte("vcgt"))); err == nil {
+		t.Fatal("expected an error for a truncated tag")
+	}
+}
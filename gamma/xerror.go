@@ -0,0 +1,99 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+/*
+#include <X11/Xlib.h>
+
+void InstallErrorHandler(void);
+int CallPrevErrorHandler(Display *dpy, XErrorEvent *ev);
+*/
+import "C"
+import (
+	"sync"
+)
+
+/*
+By default, Xlib reports X errors by printing them and exiting the process.
+To keep that from happening to applications that use this package, the first
+Client installs an error handler that records the errors of this package's
+displays, so that they can be returned as XErrors instead.  The errors of other
+displays (e.g. those opened by a GUI toolkit in the same process) are passed
+along to whichever error handler was installed before.
+*/
+var xerrors struct {
+	sync.Mutex
+	once sync.Once
+	// pending holds the first unreported error of each of this package's
+	// displays, or nil.
+	pending map[*C.Display]*XError
+}
+
+// captureXErrors installs the error handler, if it hasn't been installed
+// already, and starts recording dpy's errors.
+func captureXErrors(dpy *C.Display) {
+	xerrors.once.Do(func() {
+		xerrors.pending = make(map[*C.Display]*XError)
+		C.InstallErrorHandler()
+	})
+	xerrors.Lock()
+	defer xerrors.Unlock()
+	xerrors.pending[dpy] = nil
+}
+
+// releaseXErrors stops recording dpy's errors.
+func releaseXErrors(dpy *C.Display) {
+	xerrors.Lock()
+	defer xerrors.Unlock()
+	delete(xerrors.pending, dpy)
+}
+
+// takeXError returns and clears dpy's pending error.
+func takeXError(dpy *C.Display) error {
+	xerrors.Lock()
+	defer xerrors.Unlock()
+	if err := xerrors.pending[dpy]; err != nil {
+		xerrors.pending[dpy] = nil
+		return err
+	}
+	return nil
+}
+
+//export goXErrorHandler
+func goXErrorHandler(dpy *C.Display, ev *C.XErrorEvent) C.int {
+	xerrors.Lock()
+	pending, ours := xerrors.pending[dpy]
+	if ours && pending == nil {
+		// Keep only the first error; later ones are often its fallout.
+		xerrors.pending[dpy] = newXError(dpy, ev)
+	}
+	xerrors.Unlock()
+	if !ours {
+		return C.CallPrevErrorHandler(dpy, ev)
+	}
+	return 0
+}
+
+func newXError(dpy *C.Display, ev *C.XErrorEvent) *XError {
+	var buf [256]C.char
+	C.XGetErrorText(dpy, C.int(ev.error_code), &buf[0], C.int(len(buf)))
+	return &XError{
+		Code:    uint8(ev.error_code),
+		Request: uint8(ev.request_code),
+		Minor:   uint8(ev.minor_code),
+		Text:    C.GoString(&buf[0]),
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright 2019 Branen Salmon
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gamma
+
+/*
+#cgo LDFLAGS: -lX11 -lXrandr
+#include <stdlib.h>
+#include <X11/Xlib.h>
+#include <X11/Xatom.h>
+#include <X11/extensions/Xrandr.h>
+
+int GetDefaultScreen(Display *dpy) {
+	return DefaultScreen(dpy);
+}
+
+int GetScreenCount(Display *dpy) {
+	return ScreenCount(dpy);
+}
+
+Window GetRootWindow(Display *dpy, int screen) {
+	return RootWindow(dpy, screen);
+}
+
+extern int goXErrorHandler(Display *dpy, XErrorEvent *ev);
+
+static XErrorHandler prevErrorHandler;
+
+void InstallErrorHandler(void) {
+	prevErrorHandler = XSetErrorHandler(goXErrorHandler);
+}
+
+int CallPrevErrorHandler(Display *dpy, XErrorEvent *ev) {
+	if (prevErrorHandler == NULL) {
+		return 0;
+	}
+	return prevErrorHandler(dpy, ev);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+/*
+xbackend abstracts the handful of Xlib and XRandR calls made by Client and
+Session, so that their logic can be exercised without a live X server.
+
+xlibBackend, which calls into Xlib via cgo, is the only implementation used
+outside of tests.  Methods are named after the calls they wrap.  None of them
+are safe for concurrent use; callers must hold the owning Client's mutex.
+*/
+type xbackend interface {
+	queryExtension() bool
+	// queryVersion returns false on failure.
+	queryVersion() (major, minor int, ok bool)
+	defaultScreen() int
+	screenCount() int
+	getScreenResourcesCurrent(screen int) (xresources, error)
+	// getOutputInfo returns false on failure.
+	getOutputInfo(res xresources, output xoutput) (xoutputInfo, bool)
+	// getCrtcRotation returns a CRTC's current rotation and reflection,
+	// as a combination of the xrotate* and xreflect* bits, or false on
+	// failure.
+	getCrtcRotation(res xresources, crtc xcrtc) (int, bool)
+	// getProviders returns the providers (GPUs) of a screen, or false on
+	// failure.
+	getProviders(res xresources, screen int) ([]xproviderInfo, bool)
+	getCrtcGammaSize(crtc xcrtc) int
+	// allocGamma and getCrtcGamma return nil on failure.
+	allocGamma(size int) xgamma
+	getCrtcGamma(crtc xcrtc) xgamma
+	setCrtcGamma(crtc xcrtc, gamma xgamma)
+	// internAtom returns None (0) if the atom doesn't exist.
+	internAtom(name string) xatom
+	// queryOutputProperty returns false if the output lacks the property.
+	queryOutputProperty(output xoutput, prop xatom) (xpropertyInfo, bool)
+	// getOutputProperty32 returns false on failure or if the property's
+	// format isn't 32.
+	getOutputProperty32(output xoutput, prop xatom) ([]uint32, bool)
+	// changeOutputProperty32 replaces an output property with an array of
+	// 32-bit INTEGERs.
+	changeOutputProperty32(output xoutput, prop xatom, data []uint32)
+	// sync waits for the X server to process all requests and returns the
+	// first X error (an *XError) reported since the last call, if any.
+	sync() error
+	closeDisplay()
+}
+
+// xcrtc identifies a CRTC (i.e. it's an RRCrtc).  Zero is None.
+type xcrtc uint64
+
+// xoutput identifies an output (i.e. it's an RROutput).
+type xoutput uint64
+
+// xatom identifies an atom (i.e. it's an Atom).  Zero is None.
+type xatom uint64
+
+// These are the bits of a Rotation.
+const (
+	xrotate0   = C.RR_Rotate_0
+	xrotate90  = C.RR_Rotate_90
+	xrotate180 = C.RR_Rotate_180
+	xrotate270 = C.RR_Rotate_270
+	xreflectX  = C.RR_Reflect_X
+	xreflectY  = C.RR_Reflect_Y
+)
+
+// These identify the X error that a wrongly sized lookup table causes.
+const (
+	xBadValue       = C.BadValue
+	xRRSetCrtcGamma = C.X_RRSetCrtcGamma
+)
+
+// xresources corresponds to an XRRScreenResources.
+type xresources interface {
+	crtcs() []xcrtc
+	outputs() []xoutput
+	// configTimestamp returns the time of the screen's last configuration
+	// change.
+	configTimestamp() uint64
+	free()
+}
+
+// xoutputInfo holds the fields of an XRROutputInfo that this package uses.
+type xoutputInfo struct {
+	name string
+	crtc xcrtc
+}
+
+// xproviderInfo holds the fields of an XRRProviderInfo that this package uses.
+type xproviderInfo struct {
+	name  string
+	crtcs []xcrtc
+}
+
+// xpropertyInfo holds the fields of an XRRPropertyInfo that this package uses.
+// If isRange is true, values holds the minimum and maximum valid values.
+type xpropertyInfo struct {
+	isRange bool
+	values  []int64
+}
+
+// xgamma corresponds to an XRRCrtcGamma.  The slices returned by ramp alias
+// the underlying buffer.
+type xgamma interface {
+	ramp(ch Channel) []uint16
+	free()
+}
+
+type xlibBackend struct {
+	dpy *C.Display
+}
+
+func openXlibBackend() (*xlibBackend, error) {
+	x := new(xlibBackend)
+	if x.dpy = C.XOpenDisplay(nil); x.dpy == nil {
+		// An unset $DISPLAY is by far the most common cause, e.g. when
+		// running over SSH or from a service.
+		display := os.Getenv("DISPLAY")
+		if display == "" {
+			return nil, fmt.Errorf("DISPLAY is not set: %w", ErrNoDisplay)
+		}
+		return nil, fmt.Errorf("DISPLAY=%s: %w", display, ErrNoDisplay)
+	}
+	captureXErrors(x.dpy)
+	return x, nil
+}
+
+func (x *xlibBackend) queryExtension() bool {
+	var eventBase, errorBase C.int
+	return C.XRRQueryExtension(x.dpy, &eventBase, &errorBase) != 0
+}
+
+func (x *xlibBackend) queryVersion() (major, minor int, ok bool) {
+	var cMajor, cMinor C.int
+	if C.XRRQueryVersion(x.dpy, &cMajor, &cMinor) == 0 {
+		return
+	}
+	return int(cMajor), int(cMinor), true
+}
+
+func (x *xlibBackend) defaultScreen() int {
+	return int(C.GetDefaultScreen(x.dpy))
+}
+
+func (x *xlibBackend) screenCount() int {
+	return int(C.GetScreenCount(x.dpy))
+}
+
+func (x *xlibBackend) rootWindow(screen int) C.Window {
+	return C.GetRootWindow(x.dpy, C.int(screen))
+}
+
+func (x *xlibBackend) getScreenResourcesCurrent(screen int) (xresources, error) {
+	res := C.XRRGetScreenResourcesCurrent(x.dpy, x.rootWindow(screen))
+	if res == nil {
+		return nil, ErrScreenResources
+	}
+	return xlibResources{res}, nil
+}
+
+func (x *xlibBackend) getOutputInfo(
+	res xresources, output xoutput,
+) (info xoutputInfo, ok bool) {
+	ptr := C.XRRGetOutputInfo(x.dpy, res.(xlibResources).res, C.RROutput(output))
+	if ptr == nil {
+		return
+	}
+	defer C.XRRFreeOutputInfo(ptr)
+	info.name = C.GoStringN(ptr.name, ptr.nameLen)
+	info.crtc = xcrtc(ptr.crtc)
+	return info, true
+}
+
+func (x *xlibBackend) getCrtcRotation(
+	res xresources, crtc xcrtc,
+) (rotation int, ok bool) {
+	ptr := C.XRRGetCrtcInfo(x.dpy, res.(xlibResources).res, C.RRCrtc(crtc))
+	if ptr == nil {
+		return
+	}
+	defer C.XRRFreeCrtcInfo(ptr)
+	return int(ptr.rotation), true
+}
+
+func (x *xlibBackend) getProviders(
+	res xresources, screen int,
+) (providers []xproviderInfo, ok bool) {
+	pres := C.XRRGetProviderResources(x.dpy, x.rootWindow(screen))
+	if pres == nil {
+		return
+	}
+	defer C.XRRFreeProviderResources(pres)
+	providers = make([]xproviderInfo, pres.nproviders, pres.nproviders)
+	for idx := range providers {
+		provider := (*[1 << 28]C.RRProvider)(unsafe.Pointer(pres.providers))[idx]
+		ptr := C.XRRGetProviderInfo(x.dpy, res.(xlibResources).res, provider)
+		if ptr == nil {
+			return nil, false
+		}
+		providers[idx].name = C.GoStringN(ptr.name, ptr.nameLen)
+		providers[idx].crtcs = make([]xcrtc, ptr.ncrtcs, ptr.ncrtcs)
+		for crtcIdx := range providers[idx].crtcs {
+			providers[idx].crtcs[crtcIdx] = xcrtc((*[1 << 28]C.RRCrtc)(
+				unsafe.Pointer(ptr.crtcs))[crtcIdx])
+		}
+		C.XRRFreeProviderInfo(ptr)
+	}
+	return providers, true
+}
+
+func (x *xlibBackend) getCrtcGammaSize(crtc xcrtc) int {
+	return int(C.XRRGetCrtcGammaSize(x.dpy, C.RRCrtc(crtc)))
+}
+
+func (x *xlibBackend) allocGamma(size int) xgamma {
+	if ptr := C.XRRAllocGamma(C.int(size)); ptr != nil {
+		return xlibGamma{ptr}
+	}
+	return nil
+}
+
+func (x *xlibBackend) getCrtcGamma(crtc xcrtc) xgamma {
+	if ptr := C.XRRGetCrtcGamma(x.dpy, C.RRCrtc(crtc)); ptr != nil {
+		return xlibGamma{ptr}
+	}
+	return nil
+}
+
+func (x *xlibBackend) setCrtcGamma(crtc xcrtc, gamma xgamma) {
+	C.XRRSetCrtcGamma(x.dpy, C.RRCrtc(crtc), gamma.(xlibGamma).gamma)
+}
+
+func (x *xlibBackend) internAtom(name string) xatom {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	return xatom(C.XInternAtom(x.dpy, cName, C.True))
+}
+
+func (x *xlibBackend) queryOutputProperty(
+	output xoutput, prop xatom,
+) (info xpropertyInfo, ok bool) {
+	ptr := C.XRRQueryOutputProperty(x.dpy, C.RROutput(output), C.Atom(prop))
+	if ptr == nil {
+		return
+	}
+	defer C.XFree(unsafe.Pointer(ptr))
+	info.isRange = ptr._range != 0
+	info.values = make([]int64, ptr.num_values, ptr.num_values)
+	for idx := range info.values {
+		info.values[idx] = int64((*[1 << 28]C.long)(unsafe.Pointer(ptr.values))[idx])
+	}
+	return info, true
+}
+
+func (x *xlibBackend) getOutputProperty32(
+	output xoutput, prop xatom,
+) (data []uint32, ok bool) {
+	var (
+		actualType   C.Atom
+		actualFormat C.int
+		nitems       C.ulong
+		bytesAfter   C.ulong
+		ptr          *C.uchar
+	)
+	if C.XRRGetOutputProperty(x.dpy, C.RROutput(output), C.Atom(prop),
+		0, 1024, C.False, C.False, C.AnyPropertyType, &actualType,
+		&actualFormat, &nitems, &bytesAfter, &ptr) != C.Success {
+		return
+	}
+	if ptr == nil {
+		return
+	}
+	defer C.XFree(unsafe.Pointer(ptr))
+	if actualFormat != 32 {
+		return
+	}
+	// Xlib returns format-32 data as an array of longs.
+	longs := (*[1 << 28]C.long)(unsafe.Pointer(ptr))[:nitems:nitems]
+	data = make([]uint32, nitems, nitems)
+	for idx, v := range longs {
+		data[idx] = uint32(v)
+	}
+	return data, true
+}
+
+func (x *xlibBackend) changeOutputProperty32(
+	output xoutput, prop xatom, data []uint32,
+) {
+	// Xlib expects format-32 data as an array of longs.
+	longs := make([]C.long, len(data), len(data))
+	for idx, v := range data {
+		longs[idx] = C.long(v)
+	}
+	C.XRRChangeOutputProperty(x.dpy, C.RROutput(output), C.Atom(prop),
+		C.XA_INTEGER, 32, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(&longs[0])), C.int(len(longs)))
+}
+
+func (x *xlibBackend) sync() error {
+	C.XSync(x.dpy, C.False)
+	return takeXError(x.dpy)
+}
+
+func (x *xlibBackend) closeDisplay() {
+	// Collect any outstanding errors while the display is still registered,
+	// and unregister it before XCloseDisplay frees it: once it's freed,
+	// another Client's XOpenDisplay may reuse the pointer.
+	C.XSync(x.dpy, C.False)
+	releaseXErrors(x.dpy)
+	C.XCloseDisplay(x.dpy)
+}
+
+type xlibResources struct {
+	res *C.XRRScreenResources
+}
+
+func (r xlibResources) crtcs() []xcrtc {
+	crtcs := make([]xcrtc, r.res.ncrtc, r.res.ncrtc)
+	for idx := range crtcs {
+		crtcs[idx] = xcrtc((*[2 << 32]C.RRCrtc)(unsafe.Pointer(r.res.crtcs))[idx])
+	}
+	return crtcs
+}
+
+func (r xlibResources) outputs() []xoutput {
+	outputs := make([]xoutput, r.res.noutput, r.res.noutput)
+	for idx := range outputs {
+		outputs[idx] = xoutput((*[2 << 32]C.RROutput)(unsafe.Pointer(r.res.outputs))[idx])
+	}
+	return outputs
+}
+
+func (r xlibResources) configTimestamp() uint64 {
+	return uint64(r.res.configTimestamp)
+}
+
+func (r xlibResources) free() {
+	C.XRRFreeScreenResources(r.res)
+}
+
+type gammaVector *[65536]uint16
+
+type xlibGamma struct {
+	gamma *C.XRRCrtcGamma
+}
+
+func (g xlibGamma) ramp(ch Channel) []uint16 {
+	var gv gammaVector
+	switch ch {
+	case Red:
+		gv = (gammaVector)(unsafe.Pointer(g.gamma.red))
+	case Green:
+		gv = (gammaVector)(unsafe.Pointer(g.gamma.green))
+	case Blue:
+		gv = (gammaVector)(unsafe.Pointer(g.gamma.blue))
+	}
+	return gv[:g.gamma.size:g.gamma.size]
+}
+
+func (g xlibGamma) free() {
+	C.XRRFreeGamma(g.gamma)
+}